@@ -0,0 +1,79 @@
+package enmime
+
+import (
+	"mime"
+	"net/mail"
+	"strings"
+)
+
+// ReplyToAddresses returns the addresses a reply should go to: those of the Reply-To header if
+// present, else those of the From header.  Addresses are deduplicated, ignoring case, and
+// their display names are decoded to UTF-8.
+func (m *MIMEBody) ReplyToAddresses() []*mail.Address {
+	if addrs := m.addresses("Reply-To"); len(addrs) > 0 {
+		return addrs
+	}
+	return m.addresses("From")
+}
+
+// AllRecipients returns the addresses of the To and Cc headers, in that order, for replying to
+// all.  Bcc is never included.  Addresses are deduplicated, ignoring case, and their display
+// names are decoded to UTF-8.
+func (m *MIMEBody) AllRecipients() []*mail.Address {
+	return m.addresses("To", "Cc")
+}
+
+// Sender returns the address of the Sender header, which names the actual submitter of a
+// message sent on behalf of the From address, as by a mailing list.  The display name is
+// decoded to UTF-8.  A malformed header is parsed leniently, taking the address from between
+// angle brackets when present; false is returned if the header is absent or holds no address.
+func (m *MIMEBody) Sender() (*mail.Address, bool) {
+	value := strings.TrimSpace(m.header.Get("Sender"))
+	if value == "" {
+		return nil, false
+	}
+	parser := &mail.AddressParser{WordDecoder: &mime.WordDecoder{CharsetReader: charsetReader}}
+	if addr, err := parser.Parse(value); err == nil {
+		return addr, true
+	}
+	if list, err := parser.ParseList(value); err == nil && len(list) > 0 {
+		return list[0], true
+	}
+	name, address := "", value
+	if start := strings.Index(value, "<"); start >= 0 {
+		end := strings.Index(value[start:], ">")
+		if end < 0 {
+			return nil, false
+		}
+		name = strings.Trim(strings.TrimSpace(value[:start]), `"`)
+		address = value[start+1 : start+end]
+	}
+	address = strings.TrimSpace(address)
+	if !strings.Contains(address, "@") || strings.ContainsAny(address, " \t<>") {
+		return nil, false
+	}
+	return &mail.Address{Name: DecodeHeader(name), Address: address}, true
+}
+
+// addresses parses the address lists of the named headers, dropping duplicate addresses.
+// Headers that cannot be parsed are skipped.
+func (m *MIMEBody) addresses(keys ...string) []*mail.Address {
+	parser := &mail.AddressParser{WordDecoder: &mime.WordDecoder{CharsetReader: charsetReader}}
+	var addrs []*mail.Address
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		for _, value := range m.header[key] {
+			list, err := parser.ParseList(value)
+			if err != nil {
+				continue
+			}
+			for _, addr := range list {
+				if !seen[strings.ToLower(addr.Address)] {
+					seen[strings.ToLower(addr.Address)] = true
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,65 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"net/mail"
+	"testing"
+)
+
+func TestReplyToAddresses(t *testing.T) {
+	mime := &MIMEBody{header: mail.Header{
+		"From":     {"James <james@example.com>"},
+		"Reply-To": {"=?ISO-8859-1?Q?Fran=E7ois?= <f@example.com>, F <F@EXAMPLE.COM>"},
+	}}
+	addrs := mime.ReplyToAddresses()
+	if assert.Equal(t, len(addrs), 1, "Duplicate Reply-To should be dropped") {
+		assert.Equal(t, addrs[0].Name, "François", "Display name should be decoded")
+		assert.Equal(t, addrs[0].Address, "f@example.com", "Should use Reply-To")
+	}
+
+	mime = &MIMEBody{header: mail.Header{"From": {"James <james@example.com>"}}}
+	addrs = mime.ReplyToAddresses()
+	if assert.Equal(t, len(addrs), 1, "Should fall back to From") {
+		assert.Equal(t, addrs[0].Address, "james@example.com", "Should use From")
+	}
+}
+
+func TestAllRecipients(t *testing.T) {
+	mime := &MIMEBody{header: mail.Header{
+		"To":  {"a@example.com, B <b@example.com>"},
+		"Cc":  {"b@example.com, =?windows-1252?Q?=80uro?= <c@example.com>"},
+		"Bcc": {"secret@example.com"},
+	}}
+	addrs := mime.AllRecipients()
+	if assert.Equal(t, len(addrs), 3, "Recipients should be deduplicated, without Bcc") {
+		assert.Equal(t, addrs[0].Address, "a@example.com", "To should come first")
+		assert.Equal(t, addrs[1].Name, "B", "First occurrence should be kept")
+		assert.Equal(t, addrs[2].Name, "€uro", "Display name should be decoded")
+	}
+	assert.Nil(t, new(MIMEBody).AllRecipients(), "No headers should give no recipients")
+}
+
+func TestSender(t *testing.T) {
+	mime := &MIMEBody{header: mail.Header{
+		"From":   {"James <james@example.com>"},
+		"Sender": {"=?UTF-8?Q?List_=E2=9C=93?= <list@example.com>"},
+	}}
+	addr, ok := mime.Sender()
+	if assert.True(t, ok, "Sender should be found") {
+		assert.Equal(t, addr.Name, "List ✓", "Display name should be decoded")
+		assert.Equal(t, addr.Address, "list@example.com", "Should use Sender, not From")
+	}
+
+	mime = &MIMEBody{header: mail.Header{"Sender": {"List [bot] <list@example.com>"}}}
+	addr, ok = mime.Sender()
+	if assert.True(t, ok, "Malformed Sender should be parsed leniently") {
+		assert.Equal(t, addr.Name, "List [bot]", "Display name should be kept")
+		assert.Equal(t, addr.Address, "list@example.com", "Address should be taken from brackets")
+	}
+
+	mime = &MIMEBody{header: mail.Header{"Sender": {"undisclosed"}}}
+	_, ok = mime.Sender()
+	assert.False(t, ok, "Sender without an address should not be found")
+	_, ok = new(MIMEBody).Sender()
+	assert.False(t, ok, "Missing Sender should not be found")
+}
@@ -0,0 +1,93 @@
+package enmime
+
+import (
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ARCSet holds the headers of one instance of an Authenticated Received Chain (RFC 8617).
+// The tags of the ARC-Seal and ARC-Message-Signature headers are keyed by their lower case
+// tag name, e.g. "cv" or "d"; whitespace is removed from the base64 "b" and "bh" values.
+// A header missing from the set leaves its field empty.
+type ARCSet struct {
+	Instance              int               // Instance number from the i= tag
+	Seal                  map[string]string // Tags of the ARC-Seal header
+	MessageSignature      map[string]string // Tags of the ARC-Message-Signature header
+	AuthenticationResults string            // ARC-Authentication-Results value after i=
+}
+
+// ARCChain returns the ARC header sets found in the header of p, typically the root of a
+// message, ordered by instance number.  Parsing is lenient about spacing and tag order;
+// headers without a valid i= tag are ignored.
+func ARCChain(p MIMEPart) []ARCSet {
+	header := p.Header()
+	sets := make(map[int]*ARCSet)
+	set := func(instance int) *ARCSet {
+		if sets[instance] == nil {
+			sets[instance] = &ARCSet{Instance: instance}
+		}
+		return sets[instance]
+	}
+
+	for _, value := range header[textproto.CanonicalMIMEHeaderKey("ARC-Seal")] {
+		tags := parseTagList(value)
+		if i, ok := arcInstance(tags["i"]); ok {
+			set(i).Seal = tags
+		}
+	}
+	for _, value := range header[textproto.CanonicalMIMEHeaderKey("ARC-Message-Signature")] {
+		tags := parseTagList(value)
+		if i, ok := arcInstance(tags["i"]); ok {
+			set(i).MessageSignature = tags
+		}
+	}
+	for _, value := range header[textproto.CanonicalMIMEHeaderKey("ARC-Authentication-Results")] {
+		// The instance tag is followed by an ordinary Authentication-Results value
+		parts := strings.SplitN(value, ";", 2)
+		tags := parseTagList(parts[0])
+		if i, ok := arcInstance(tags["i"]); ok {
+			aar := ""
+			if len(parts) > 1 {
+				aar = strings.TrimSpace(parts[1])
+			}
+			set(i).AuthenticationResults = aar
+		}
+	}
+
+	chain := make([]ARCSet, 0, len(sets))
+	for _, s := range sets {
+		chain = append(chain, *s)
+	}
+	sort.Slice(chain, func(a, b int) bool { return chain[a].Instance < chain[b].Instance })
+	return chain
+}
+
+// arcInstance parses the value of an i= tag, which must be a positive number.
+func arcInstance(value string) (int, bool) {
+	i, err := strconv.Atoi(value)
+	return i, err == nil && i > 0
+}
+
+// parseTagList parses a DKIM style tag list (RFC 6376), such as "i=1; a=rsa-sha256; d=x",
+// into a map keyed by lower case tag name.  Malformed entries are skipped.
+func parseTagList(value string) map[string]string {
+	tags := make(map[string]string)
+	for _, field := range strings.Split(value, ";") {
+		eq := strings.Index(field, "=")
+		if eq < 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(field[:eq]))
+		val := strings.TrimSpace(field[eq+1:])
+		if name == "" {
+			continue
+		}
+		if name == "b" || name == "bh" {
+			val = strings.Join(strings.Fields(val), "")
+		}
+		tags[name] = val
+	}
+	return tags
+}
@@ -0,0 +1,46 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"net/textproto"
+	"testing"
+)
+
+func TestARCChain(t *testing.T) {
+	msg := readMessage("arc.raw")
+	mime, err := ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	chain := ARCChain(mime.Root)
+	if !assert.Equal(t, len(chain), 2, "Chain should have two sets") {
+		t.FailNow()
+	}
+
+	assert.Equal(t, chain[0].Instance, 1, "First set should be instance 1")
+	assert.Equal(t, chain[0].Seal["cv"], "none", "Seal cv should be parsed regardless of order")
+	assert.Equal(t, chain[0].Seal["b"], "c2VhbDE=", "Seal signature should be parsed")
+	assert.Equal(t, chain[0].MessageSignature["d"], "origin.example",
+		"Spacing around tags should be ignored")
+	assert.Equal(t, chain[0].MessageSignature["b"], "bXNnMQ==",
+		"Folded signature should have whitespace removed")
+	assert.Equal(t, chain[0].AuthenticationResults,
+		"mx.origin.example; spf=pass smtp.mailfrom=origin.example",
+		"Authentication results should follow the instance tag")
+
+	assert.Equal(t, chain[1].Instance, 2, "Second set should be instance 2")
+	assert.Equal(t, chain[1].Seal["cv"], "pass", "Seal cv should be parsed")
+	assert.Equal(t, chain[1].Seal["b"], "c2VhbDIhYmM=",
+		"Folded signature should have whitespace removed")
+	assert.Equal(t, chain[1].MessageSignature["h"], "from:to:subject",
+		"Signed headers should be parsed")
+	assert.Equal(t, chain[1].AuthenticationResults,
+		"relay.example; dkim=pass header.d=origin.example; arc=pass",
+		"Authentication results should be parsed")
+}
+
+func TestARCChainMissing(t *testing.T) {
+	part := &memMIMEPart{header: textproto.MIMEHeader{"Subject": {"No ARC"}}}
+	assert.Equal(t, len(ARCChain(part)), 0, "Chain should be empty without ARC headers")
+}
@@ -2,14 +2,16 @@ package enmime
 
 import (
 	"io"
+	"regexp"
 )
 
 // Base64Cleaner helps work around bugs in Go's built-in base64 decoder by stripping out
 // whitespace that would cause Go to lose count of things and issue an "illegal base64 data at
-// input byte..." error
+// input byte..." error.  Spaces and tabs are stripped anywhere, which also recovers content
+// from encoders that fold base64 lines with leading whitespace like a header continuation.
 type Base64Cleaner struct {
-	in    io.Reader
-	buf   [1024]byte
+	in  io.Reader
+	buf [1024]byte
 	//count int64
 }
 
@@ -41,3 +43,37 @@ func (qp *Base64Cleaner) Read(p []byte) (n int, err error) {
 	//qp.count += int64(n)
 	return n, err
 }
+
+// maxInvalidBase64Ratio is the fraction of non-base64 characters above which content labeled
+// base64 is assumed not to be encoded at all.
+const maxInvalidBase64Ratio = 0.05
+
+// invalidBase64Ratio returns the fraction of non-whitespace bytes in data that are not part of
+// the base64 alphabet.
+func invalidBase64Ratio(data []byte) float64 {
+	total, invalid := 0, 0
+	for _, b := range data {
+		switch {
+		case b == ' ', b == '\t', b == '\r', b == '\n':
+			continue
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '+', b == '/', b == '=':
+		default:
+			invalid++
+		}
+		total++
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(invalid) / float64(total)
+}
+
+// qpEscape matches a quoted-printable escaped byte, which never appears in valid base64.
+var qpEscape = regexp.MustCompile(`=[0-9A-F]{2}`)
+
+// looksLikeQP returns true if data, which failed to decode as base64, contains quoted-printable
+// escapes such as "=E9" and so was most likely mislabeled.
+func looksLikeQP(data []byte) bool {
+	return qpEscape.Match(data)
+}
@@ -1,6 +1,7 @@
 package enmime
 
 import (
+	"bufio"
 	"bytes"
 	"github.com/stretchrcom/testify/assert"
 	"strings"
@@ -15,3 +16,27 @@ func TestBase64Cleaner(t *testing.T) {
 
 	assert.Equal(t, buf.String(), "ABC")
 }
+
+func TestInvalidBase64Ratio(t *testing.T) {
+	assert.Equal(t, invalidBase64Ratio([]byte("QUJD\r\nREVG\r\n")), 0.0)
+	assert.Equal(t, invalidBase64Ratio([]byte("ab!?")), 0.5)
+	assert.Equal(t, invalidBase64Ratio([]byte(" \r\n")), 0.0)
+}
+
+func TestBase64CleanerFolded(t *testing.T) {
+	raw := "Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"VGhpcyBh\r\n" +
+		"\tdHRhY2ht\r\n" +
+		"\t ZW50IHdh\r\n" +
+		"  cyBtaXMt\r\n" +
+		"\tZm9sZGVk\r\n"
+	p, err := ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(p.Content()), "This attachment was mis-folded",
+		"Indented base64 lines should decode")
+}
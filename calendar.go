@@ -0,0 +1,136 @@
+package enmime
+
+import (
+	"mime"
+	"strings"
+	"time"
+)
+
+// CalEvent holds the main properties of the first event in a calendar invitation.
+type CalEvent struct {
+	Method   string    // iCalendar METHOD, e.g. "REQUEST", "CANCEL" or "REPLY"
+	UID      string    // Unique identifier of the event, shared by its updates
+	Summary  string    // Title of the event
+	Start    time.Time // Start time, zero if missing or not understood
+	RawStart string    // DTSTART value as found in the calendar
+}
+
+// CalendarEvent locates the first text/calendar part below root and returns the method of the
+// calendar along with the UID, SUMMARY and DTSTART of its first VEVENT.  Only these top-level
+// event properties are parsed; properties of nested components such as VALARM are ignored.
+// The method is taken from the METHOD property, or the method parameter of the Content-Type.
+// ok is false if there is no calendar part or it contains no event.
+func CalendarEvent(root MIMEPart) (event *CalEvent, ok bool) {
+	part := BreadthMatchFirst(root, func(p MIMEPart) bool {
+		return p.ContentType() == "text/calendar"
+	})
+	if part == nil {
+		return nil, false
+	}
+	content, err := UTF8Content(part)
+	if err != nil {
+		content = part.Content()
+	}
+
+	event = new(CalEvent)
+	depth := 0 // Nesting depth within the VEVENT, 0 when outside of it
+	found := false
+	for _, line := range unfoldICS(string(content)) {
+		name, params, value := parseICSLine(line)
+		switch {
+		case name == "BEGIN" && (depth > 0 || strings.EqualFold(value, "VEVENT") && !found):
+			depth++
+			found = true
+		case name == "END" && depth > 0:
+			depth--
+		case name == "METHOD" && depth == 0:
+			event.Method = strings.ToUpper(value)
+		case depth == 1:
+			switch name {
+			case "UID":
+				event.UID = value
+			case "SUMMARY":
+				event.Summary = unescapeICS(value)
+			case "DTSTART":
+				event.RawStart = value
+				event.Start = parseICSTime(value, params)
+			}
+		}
+	}
+	if !found {
+		return nil, false
+	}
+	if event.Method == "" {
+		_, ctparams, err := mime.ParseMediaType(part.Header().Get("Content-Type"))
+		if err == nil {
+			event.Method = strings.ToUpper(ctparams["method"])
+		}
+	}
+	return event, true
+}
+
+// unfoldICS splits iCalendar content into lines, joining folded continuation lines, which
+// begin with a space or tab (RFC 5545, section 3.1).
+func unfoldICS(content string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.Replace(content, "\r\n", "\n", -1), "\n") {
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseICSLine splits a content line such as "DTSTART;TZID=Europe/Paris:20240115T090000"
+// into its upper case property name, parameters keyed by upper case name, and value.
+func parseICSLine(line string) (name string, params map[string]string, value string) {
+	params = make(map[string]string)
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", params, ""
+	}
+	fields := strings.Split(line[:colon], ";")
+	for _, param := range fields[1:] {
+		if eq := strings.Index(param, "="); eq > 0 {
+			params[strings.ToUpper(param[:eq])] = strings.Trim(param[eq+1:], `"`)
+		}
+	}
+	return strings.ToUpper(strings.TrimSpace(fields[0])), params, strings.TrimSpace(line[colon+1:])
+}
+
+// unescapeICS removes the backslash escapes from an iCalendar TEXT value.
+func unescapeICS(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).
+		Replace(value)
+}
+
+// parseICSTime parses an iCalendar DATE or DATE-TIME value, honoring a TZID parameter naming
+// a known time zone.  Floating times without a zone are interpreted as UTC.  It returns the
+// zero time if the value cannot be parsed.
+func parseICSTime(value string, params map[string]string) time.Time {
+	loc := time.UTC
+	if strings.HasSuffix(value, "Z") {
+		value = strings.TrimSuffix(value, "Z")
+	} else if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	for _, layout := range []string{"20060102T150405", "20060102"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,74 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendarEvent(t *testing.T) {
+	msg := readMessage("calendar.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	event, ok := CalendarEvent(mime.Root)
+	if !assert.True(t, ok, "Should have found an event") {
+		t.FailNow()
+	}
+	assert.Equal(t, event.Method, "REQUEST", "Should have method")
+	assert.Equal(t, event.UID, "4f1c0a52-enmime@makita.skynet", "Should have UID")
+	assert.Equal(t, event.Summary,
+		"Planning, quarterly review with a very long title that is folded by the sender",
+		"Summary should be unfolded and unescaped, ignoring the alarm")
+	assert.Equal(t, event.RawStart, "20240115T090000", "Should have raw start")
+	assert.True(t, event.Start.Equal(time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)),
+		"Start should honor TZID, got %v", event.Start)
+}
+
+func TestCalendarEventQuotedPrintable(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=\"Enmime-Cancel\"\r\n" +
+		"\r\n" +
+		"--Enmime-Cancel\r\n" +
+		"Content-Type: text/calendar; method=CANCEL\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:cancel=3D1@example.com\r\n" +
+		"SUMMARY:Caf=C3=A9 meeting\r\n" +
+		"DTSTART:20240201T140000Z\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n" +
+		"--Enmime-Cancel--\r\n"
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	event, ok := CalendarEvent(mime.Root)
+	if !assert.True(t, ok, "Should have found an event") {
+		t.FailNow()
+	}
+	assert.Equal(t, event.Method, "CANCEL", "Method should come from the Content-Type")
+	assert.Equal(t, event.UID, "cancel=1@example.com", "UID should be decoded")
+	assert.Equal(t, event.Summary, "Café meeting", "Summary should be decoded")
+	assert.True(t, event.Start.Equal(time.Date(2024, 2, 1, 14, 0, 0, 0, time.UTC)),
+		"Start should be UTC, got %v", event.Start)
+}
+
+func TestCalendarEventMissing(t *testing.T) {
+	mime, err := ParseMIMEBody(readMessage("html-mime-inline.raw"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	_, ok := CalendarEvent(mime.Root)
+	assert.False(t, ok, "Should not find an event")
+}
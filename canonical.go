@@ -0,0 +1,123 @@
+package enmime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+)
+
+// volatileHeaders lists the header fields that relays and filters add or modify in transit,
+// which Canonicalize leaves out.
+var volatileHeaders = map[string]bool{
+	"Received":                   true,
+	"Return-Path":                true,
+	"Delivered-To":               true,
+	"Authentication-Results":     true,
+	"Received-Spf":               true,
+	"Dkim-Signature":             true,
+	"Arc-Seal":                   true,
+	"Arc-Message-Signature":      true,
+	"Arc-Authentication-Results": true,
+	"Content-Length":             true,
+	"Content-Transfer-Encoding":  true,
+}
+
+// canonicalLineLength is the length of the base64 lines written by Canonicalize.
+const canonicalLineLength = 76
+
+// Canonicalize serializes the message rooted at root in a normalized MIME form, so that
+// messages differing only in how they were encoded or relayed produce the same bytes, for
+// deduplication and regression snapshots.  The following is normalized:
+//
+//   - header fields are written in order of their canonical names, values of a repeated
+//     field keeping their original order, and folded values are unfolded with runs of
+//     whitespace collapsed to a single space
+//   - the volatile fields Received, Return-Path, Delivered-To, Authentication-Results,
+//     Received-SPF, DKIM-Signature, the ARC-* set, X-* fields and Content-Length are dropped
+//   - the Content-Type is formatted as by ContentTypeString, with a charset of utf-8 for text
+//     converted by the parser, and a boundary derived from the PathIndex of each multipart,
+//     such as =_enmime_1.2_=
+//   - the decoded content of every leaf part is base64 encoded, in lines of 76 characters
+//   - multipart preambles and epilogues are dropped
+//   - all lines end with CRLF
+//
+// Parts are otherwise written in tree order, so the order of the parts is significant.
+func Canonicalize(root MIMEPart) ([]byte, error) {
+	if root == nil {
+		return nil, fmt.Errorf("Cannot canonicalize a nil part")
+	}
+	buf := new(bytes.Buffer)
+	writeCanonical(buf, root)
+	return buf.Bytes(), nil
+}
+
+// writeCanonical writes the canonical form of p and its descendants to buf.
+func writeCanonical(buf *bytes.Buffer, p MIMEPart) {
+	keys := make([]string, 0, len(p.Header()))
+	for key := range p.Header() {
+		if !volatileHeaders[key] && !strings.HasPrefix(key, "X-") && key != "Content-Type" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range p.Header()[key] {
+			fmt.Fprintf(buf, "%v: %v\r\n", key, strings.Join(strings.Fields(value), " "))
+		}
+	}
+
+	path := PathIndex(p)
+	if path == "" {
+		path = "0"
+	}
+	// Delimited so that no boundary is a prefix of another, see CheckBoundaries
+	boundary := "=_enmime_" + path + "_="
+	if ctype := canonicalContentType(p, boundary); ctype != "" {
+		fmt.Fprintf(buf, "Content-Type: %v\r\n", ctype)
+	}
+	if strings.HasPrefix(p.ContentType(), "multipart/") {
+		buf.WriteString("\r\n")
+		for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+			fmt.Fprintf(buf, "--%v\r\n", boundary)
+			writeCanonical(buf, c)
+		}
+		fmt.Fprintf(buf, "--%v--\r\n", boundary)
+		return
+	}
+
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString(p.Content())
+	for len(encoded) > canonicalLineLength {
+		buf.WriteString(encoded[:canonicalLineLength] + "\r\n")
+		encoded = encoded[canonicalLineLength:]
+	}
+	if encoded != "" {
+		buf.WriteString(encoded + "\r\n")
+	}
+}
+
+// canonicalContentType returns the normalized Content-Type of p for Canonicalize, using the
+// given boundary for a multipart.
+func canonicalContentType(p MIMEPart, boundary string) string {
+	if p.ContentType() == "" {
+		return ""
+	}
+	_, params, err := parseMediaType(p.Header().Get("Content-Type"))
+	if err != nil || params == nil {
+		params = make(map[string]string)
+	}
+	delete(params, "boundary")
+	if strings.HasPrefix(p.ContentType(), "multipart/") {
+		params["boundary"] = boundary
+	}
+	if Charset(p) == "utf-8" {
+		params["charset"] = "utf-8"
+	}
+	if value := mime.FormatMediaType(p.ContentType(), params); value != "" {
+		return value
+	}
+	return p.ContentType()
+}
@@ -0,0 +1,68 @@
+package enmime
+
+import (
+	"bufio"
+	"github.com/stretchrcom/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	first := "Received: from relay1.example.com\r\n" +
+		"Subject: Canonical\r\n" +
+		"  form\r\n" +
+		"From: james@example.com\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"first\"\r\n" +
+		"\r\n" +
+		"Preamble\r\n" +
+		"--first\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"caf=E9\r\n" +
+		"--first--\r\n"
+	second := "From: james@example.com\r\n" +
+		"X-Spam-Score: 0.1\r\n" +
+		"Subject: Canonical form\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"second\"\r\n" +
+		"\r\n" +
+		"--second\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"Y2Fmw6k=\r\n" +
+		"--second--\r\n" +
+		"Epilogue\r\n"
+	canonical := func(raw string) string {
+		root, err := ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+		if err != nil {
+			t.Fatalf("Failed to parse MIME: %v", err)
+		}
+		data, err := Canonicalize(root)
+		if err != nil {
+			t.Fatalf("Failed to canonicalize: %v", err)
+		}
+		return string(data)
+	}
+
+	assert.Equal(t, canonical(first), "From: james@example.com\r\n"+
+		"Subject: Canonical form\r\n"+
+		"Content-Type: multipart/mixed; boundary=\"=_enmime_0_=\"\r\n"+
+		"\r\n"+
+		"--=_enmime_0_=\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n"+
+		"Content-Transfer-Encoding: base64\r\n"+
+		"\r\n"+
+		"Y2Fmw6k=\r\n"+
+		"--=_enmime_0_=--\r\n", "Unexpected canonical form")
+	assert.Equal(t, canonical(first), canonical(second),
+		"Differently encoded and relayed messages should be identical")
+
+	root, err := ParseMIME(bufio.NewReader(strings.NewReader(canonical(first))))
+	if assert.Nil(t, err, "Canonical form should parse") {
+		assert.Equal(t, string(root.FirstChild().Content()), "café", "Content should round-trip")
+	}
+
+	_, err = Canonicalize(nil)
+	assert.NotNil(t, err, "Nil root should generate an error")
+}
@@ -0,0 +1,122 @@
+package enmime
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// UTF8Content returns the decoded content of a text part, converted to UTF-8 from the charset
+// reported by Charset, or else the charset named in its Content-Type header.  Parts
+// produced by the parser have their text already converted, so for them this only differs from
+// Content when the charset is not supported, in which case an error is returned.
+// Byte sequences that are still not valid UTF-8 after conversion, typically because the
+// declared charset was wrong, are replaced with U+FFFD.  The content of non-text parts is
+// returned unchanged.
+func UTF8Content(p MIMEPart) ([]byte, error) {
+	return new(Parser).UTF8Content(p)
+}
+
+// UTF8Content returns the content of a text part converted to UTF-8 like the package level
+// UTF8Content function, using the options set on the Parser.
+func (p *Parser) UTF8Content(part MIMEPart) ([]byte, error) {
+	if !strings.HasPrefix(part.ContentType(), "text/") {
+		return part.Content(), nil
+	}
+	decoder, err := charsetDecoder(contentCharset(part))
+	if err != nil {
+		return nil, err
+	}
+	content := part.Content()
+	if decoder != nil {
+		content, err = decoder.Bytes(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !p.KeepInvalidUTF8 && !utf8.Valid(content) {
+		content, _, err = transform.Bytes(runes.ReplaceIllFormed(), content)
+	}
+	return content, err
+}
+
+// UTF8Reader returns a reader of the decoded content of a text part converted to UTF-8, like
+// UTF8Content.  The part's Content is already held in memory, so this does not stream from the
+// message; only the conversion is done as the reader is read, so the converted text is never
+// held in memory as a whole.  It returns an error if the charset is not supported, or if the
+// part is not text; use Content for other parts.
+func UTF8Reader(p MIMEPart) (io.Reader, error) {
+	return new(Parser).UTF8Reader(p)
+}
+
+// UTF8Reader returns a reader of the content of a text part converted to UTF-8 like the
+// package level UTF8Reader function, using the options set on the Parser.
+func (p *Parser) UTF8Reader(part MIMEPart) (io.Reader, error) {
+	if !strings.HasPrefix(part.ContentType(), "text/") {
+		return nil, fmt.Errorf("Not a text part: %v", part.ContentType())
+	}
+	r, err := charsetReader(contentCharset(part), bytes.NewReader(part.Content()))
+	if err != nil || p.KeepInvalidUTF8 {
+		return r, err
+	}
+	return transform.NewReader(r, runes.ReplaceIllFormed()), nil
+}
+
+// ContentStringLF returns the content of a part as a string like UTF8Content, with the line
+// endings of text parts normalized to LF: CRLF and lone CR line breaks are both replaced.
+// Normalization is only applied to text content types; other parts are returned unchanged.
+func ContentStringLF(p MIMEPart) (string, error) {
+	content, err := UTF8Content(p)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(p.ContentType(), "text/") {
+		return string(content), nil
+	}
+	content = bytes.Replace(content, []byte("\r\n"), []byte("\n"), -1)
+	return string(bytes.Replace(content, []byte("\r"), []byte("\n"), -1)), nil
+}
+
+// contentCharset returns the charset of the part's content: the charset reported by the part,
+// or the charset parameter of its Content-Type header if it does not report one.
+func contentCharset(p MIMEPart) string {
+	if charset := Charset(p); charset != "" {
+		return charset
+	}
+	return partCharset(p)
+}
+
+// partCharset returns the charset parameter of the part's Content-Type header.
+func partCharset(p MIMEPart) string {
+	_, params, _ := mime.ParseMediaType(p.Header().Get("Content-Type"))
+	return params["charset"]
+}
+
+// charsetDecoder returns a decoder that converts from charset to UTF-8, or nil if no
+// conversion is required.
+func charsetDecoder(charset string) (*encoding.Decoder, error) {
+	charset = cleanCharset(charset)
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return nil, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("Unsupported charset: %v", charset)
+	}
+	return enc.NewDecoder(), nil
+}
+
+// cleanCharset normalizes a charset label for lookup, removing surrounding whitespace and the
+// quotes some mailers leave around the label, as in charset='UTF-8', and converting it to
+// lower case.
+func cleanCharset(charset string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(charset), "\"' \t"))
+}
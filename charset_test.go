@@ -0,0 +1,222 @@
+package enmime
+
+import (
+	"bufio"
+	"github.com/stretchrcom/testify/assert"
+	"io/ioutil"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestUTF8ContentLatin1(t *testing.T) {
+	p := &memMIMEPart{contentType: "text/plain", content: []byte("caf\xe9"),
+		header: textproto.MIMEHeader{"Content-Type": {"text/plain; charset=ISO-8859-1"}}}
+
+	content, err := UTF8Content(p)
+	if !assert.Nil(t, err, "Conversion should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(content), "café", "Content should be converted to UTF-8")
+}
+
+func TestUTF8ContentUnchanged(t *testing.T) {
+	p := &memMIMEPart{contentType: "text/plain", content: []byte("café"),
+		header: textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}}}
+	content, err := UTF8Content(p)
+	assert.Nil(t, err, "UTF-8 content should not generate an error")
+	assert.Equal(t, string(content), "café", "UTF-8 content should be unchanged")
+
+	p = &memMIMEPart{contentType: "image/png", content: []byte{0x89, 'P', 'N', 'G', 0xe9},
+		header: textproto.MIMEHeader{"Content-Type": {"image/png; charset=iso-8859-1"}}}
+	content, err = UTF8Content(p)
+	assert.Nil(t, err, "Binary content should not generate an error")
+	assert.Equal(t, content, []byte{0x89, 'P', 'N', 'G', 0xe9}, "Binary content should be unchanged")
+}
+
+func TestUTF8ContentUnknownCharset(t *testing.T) {
+	p := &memMIMEPart{contentType: "text/plain", content: []byte("text"),
+		header: textproto.MIMEHeader{"Content-Type": {"text/plain; charset=x-bogus"}}}
+
+	_, err := UTF8Content(p)
+	assert.NotNil(t, err, "Unknown charset should generate an error")
+}
+
+func TestUTF8Reader(t *testing.T) {
+	p := &memMIMEPart{contentType: "text/plain", content: []byte("caf\xe9"),
+		header: textproto.MIMEHeader{"Content-Type": {"text/plain; charset=windows-1252"}}}
+
+	r, err := UTF8Reader(p)
+	if !assert.Nil(t, err, "Creating reader should not have generated an error") {
+		t.FailNow()
+	}
+	content, err := ioutil.ReadAll(r)
+	assert.Nil(t, err, "Reading should not have generated an error")
+	assert.Equal(t, string(content), "café", "Content should be converted to UTF-8")
+
+	p = &memMIMEPart{contentType: "image/png", content: []byte{0x89, 'P', 'N', 'G'}}
+	_, err = UTF8Reader(p)
+	assert.NotNil(t, err, "Non-text part should generate an error")
+}
+
+func TestUTF8ContentInvalid(t *testing.T) {
+	p := &memMIMEPart{contentType: "text/plain", content: []byte("caf\xe9 ok"),
+		header: textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}}}
+
+	content, err := UTF8Content(p)
+	assert.Nil(t, err, "Invalid UTF-8 should not generate an error")
+	assert.Equal(t, string(content), "caf� ok", "Invalid UTF-8 should be replaced")
+
+	r, err := UTF8Reader(p)
+	if !assert.Nil(t, err, "Creating reader should not have generated an error") {
+		t.FailNow()
+	}
+	content, err = ioutil.ReadAll(r)
+	assert.Nil(t, err, "Reading should not have generated an error")
+	assert.Equal(t, string(content), "caf� ok", "Invalid UTF-8 should be replaced")
+
+	parser := &Parser{KeepInvalidUTF8: true}
+	content, err = parser.UTF8Content(p)
+	assert.Nil(t, err, "Invalid UTF-8 should not generate an error")
+	assert.Equal(t, string(content), "caf\xe9 ok", "Invalid UTF-8 should be kept")
+
+	r, err = parser.UTF8Reader(p)
+	if !assert.Nil(t, err, "Creating reader should not have generated an error") {
+		t.FailNow()
+	}
+	content, err = ioutil.ReadAll(r)
+	assert.Nil(t, err, "Reading should not have generated an error")
+	assert.Equal(t, string(content), "caf\xe9 ok", "Invalid UTF-8 should be kept")
+}
+
+func TestContentStringLF(t *testing.T) {
+	p := &memMIMEPart{contentType: "text/plain", content: []byte("one\r\ntwo\rthree\nfour\xe9"),
+		header: textproto.MIMEHeader{"Content-Type": {"text/plain; charset=iso-8859-1"}}}
+	content, err := ContentStringLF(p)
+	assert.Nil(t, err, "Conversion should not have generated an error")
+	assert.Equal(t, content, "one\ntwo\nthree\nfouré", "Line endings should be normalized")
+
+	p = &memMIMEPart{contentType: "application/octet-stream", content: []byte("bin\r\nary\r")}
+	content, err = ContentStringLF(p)
+	assert.Nil(t, err, "Binary content should not generate an error")
+	assert.Equal(t, content, "bin\r\nary\r", "Binary content should be unchanged")
+}
+
+func TestParseConvertsCharset(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=\"Enmime-Charset\"\r\n" +
+		"\r\n" +
+		"--Enmime-Charset\r\n" +
+		"Content-Type: text/plain; charset=ISO-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"caf=E9\r\n" +
+		"--Enmime-Charset\r\n" +
+		"Content-Type: text/html; charset=windows-1252\r\n" +
+		"\r\n" +
+		"\x80 5\r\n" +
+		"--Enmime-Charset\r\n" +
+		"Content-Type: text/plain; charset=Shift_JIS\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"=93=FA=96=7B=8C=EA\r\n" +
+		"--Enmime-Charset\r\n" +
+		"Content-Type: text/plain; charset=big5\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"=A4=A4=A4=E5\r\n" +
+		"--Enmime-Charset\r\n" +
+		"Content-Type: application/octet-stream; charset=iso-8859-1\r\n" +
+		"\r\n" +
+		"\xe9\xff\r\n" +
+		"--Enmime-Charset\r\n" +
+		"Content-Type: text/plain; charset=x-bogus\r\n" +
+		"\r\n" +
+		"caf\xe9\r\n" +
+		"--Enmime-Charset--\r\n"
+	p := new(Parser)
+	root, err := p.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+
+	latin1 := root.FirstChild()
+	assert.Equal(t, string(latin1.Content()), "café", "Latin-1 should be converted")
+	assert.Equal(t, Charset(latin1), "utf-8", "Converted content should be UTF-8")
+	content, err := UTF8Content(latin1)
+	assert.Nil(t, err, "Converted content should not generate an error")
+	assert.Equal(t, string(content), "café", "Converted content should not be converted again")
+
+	windows := latin1.NextSibling()
+	assert.Equal(t, string(windows.Content()), "€ 5", "Windows-1252 should be converted")
+	sjis := windows.NextSibling()
+	assert.Equal(t, string(sjis.Content()), "日本語", "Shift_JIS should be converted")
+	big5 := sjis.NextSibling()
+	assert.Equal(t, string(big5.Content()), "中文", "Big5 should be converted")
+
+	binary := big5.NextSibling()
+	assert.Equal(t, binary.Content(), []byte{0xe9, 0xff}, "Binary content should be untouched")
+
+	bogus := binary.NextSibling()
+	assert.Equal(t, string(bogus.Content()), "caf\xe9", "Unsupported charset should be kept")
+	assert.Equal(t, Charset(bogus), "x-bogus", "Unsupported charset should be reported")
+	if assert.Equal(t, len(p.errors), 1, "Unsupported charset should be recorded") {
+		assert.Equal(t, p.errors[0].Name, "Unsupported Charset", "Error should name the problem")
+	}
+}
+
+func TestCharsetLabelQuirks(t *testing.T) {
+	for _, label := range []string{`"iso-8859-1 "`, `'ISO-8859-1'`, `" Latin1"`} {
+		p := &memMIMEPart{contentType: "text/plain", content: []byte("caf\xe9"),
+			header: textproto.MIMEHeader{"Content-Type": {"text/plain; charset=" + label}}}
+		content, err := UTF8Content(p)
+		assert.Nil(t, err, "Label %v should be recognized", label)
+		assert.Equal(t, string(content), "café", "Label %v should be converted", label)
+	}
+
+	raw := "Content-Type: text/plain; charset=\"windows-1252 \"\r\n\r\n\x80 5"
+	parser := new(Parser)
+	root, err := parser.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(root.Content()), "€ 5", "Padded label should be converted")
+	assert.Equal(t, len(parser.UnknownCharsets()), 0, "Padded label should not be unknown")
+}
+
+func TestEightBitASCII(t *testing.T) {
+	raw := "Content-Type: text/plain; charset=us-ascii\r\n\r\n\x93caf\xe9\x94"
+	p := new(Parser)
+	root, err := p.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(root.Content()), "“café”", "8-bit bytes should be Windows-1252")
+	assert.Equal(t, Charset(root), "utf-8", "Converted content should be UTF-8")
+	if assert.Equal(t, len(p.errors), 1, "Mislabeled content should be recorded") {
+		assert.Equal(t, p.errors[0].Name, "8-bit ASCII", "Error should name the problem")
+	}
+
+	p = &Parser{ASCIIFallbackCharset: "iso-8859-15"}
+	root, err = p.ParseMIME(bufio.NewReader(strings.NewReader(
+		"Content-Type: text/plain; charset=us-ascii\r\n\r\n\xa4 5")))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(root.Content()), "€ 5", "Configured fallback should be used")
+
+	p = &Parser{ASCIIFallbackCharset: "us-ascii"}
+	root, err = p.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(root.Content()), "\x93caf\xe9\x94", "Content should be kept as is")
+
+	p = new(Parser)
+	root, err = p.ParseMIME(bufio.NewReader(strings.NewReader(
+		"Content-Type: text/plain; charset=us-ascii\r\n\r\ncafé")))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(root.Content()), "café", "Valid UTF-8 should be left alone")
+	assert.Equal(t, len(p.errors), 0, "Valid UTF-8 should not be recorded")
+}
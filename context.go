@@ -0,0 +1,56 @@
+package enmime
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/mail"
+)
+
+// ParseWithContext reads a message from r and parses it like ParseMIMEBody, aborting when ctx
+// is cancelled or its deadline passes, in which case ctx.Err() is returned.  This bounds the
+// time spent on untrusted input fed from the network.  The context is checked before every
+// read from r and between parts; a read that is already blocked cannot be interrupted, so r
+// should also have a deadline of its own, as a net.Conn can.
+func ParseWithContext(ctx context.Context, r io.Reader) (*MIMEBody, error) {
+	return new(Parser).ParseWithContext(ctx, r)
+}
+
+// ParseWithContext reads and parses a message like the package level ParseWithContext
+// function, using the options set on the Parser.
+func (p *Parser) ParseWithContext(ctx context.Context, r io.Reader) (*MIMEBody, error) {
+	p.ctx = ctx
+	defer func() { p.ctx = nil }()
+
+	source := &countingReader{in: &contextReader{ctx: ctx, in: r}}
+	br := bufio.NewReader(source)
+	msg, err := mail.ReadMessage(br)
+	if err == nil {
+		var mime *MIMEBody
+		mime, err = p.ParseMIMEBody(msg)
+		// Data read ahead into br was not consumed
+		p.bytesRead = source.n - int64(br.Buffered())
+		if err == nil {
+			return mime, nil
+		}
+	}
+	p.bytesRead = source.n - int64(br.Buffered())
+	if ctx.Err() != nil {
+		// Readers along the way may have wrapped or replaced the context error
+		return nil, ctx.Err()
+	}
+	return nil, err
+}
+
+// contextReader is an io.Reader that fails once its context is done.
+type contextReader struct {
+	ctx context.Context
+	in  io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.in.Read(p)
+}
@@ -0,0 +1,53 @@
+package enmime
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchrcom/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestParseWithContext(t *testing.T) {
+	mime, err := ParseWithContext(context.Background(),
+		bytes.NewReader(readRaw("html-mime-inline.raw")))
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Contains(t, mime.Html, "Test of HTML section", "Should have html section")
+}
+
+// slowReader returns one byte per read, sleeping before each.
+type slowReader struct {
+	data  []byte
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.delay)
+	p[0] = r.data[0]
+	r.data = r.data[1:]
+	return 1, nil
+}
+
+func TestParseWithContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	r := &slowReader{data: readRaw("html-mime-inline.raw"), delay: time.Millisecond}
+
+	_, err := ParseWithContext(ctx, r)
+	assert.Equal(t, err, context.DeadlineExceeded, "Parsing should have been aborted")
+}
+
+func TestParseWithContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ParseWithContext(ctx, bytes.NewReader(readRaw("html-mime-inline.raw")))
+	assert.Equal(t, err, context.Canceled, "Parsing should not have started")
+}
@@ -0,0 +1,127 @@
+package enmime
+
+import (
+	"mime"
+	"strings"
+)
+
+const (
+	pgpMessageBegin   = "-----BEGIN PGP MESSAGE-----"
+	pgpMessageEnd     = "-----END PGP MESSAGE-----"
+	pgpSignedBegin    = "-----BEGIN PGP SIGNED MESSAGE-----"
+	pgpSignatureBegin = "-----BEGIN PGP SIGNATURE-----"
+	pgpSignatureEnd   = "-----END PGP SIGNATURE-----"
+)
+
+// IsEncrypted returns true if the message is encrypted, along with the encryption protocol.
+// For PGP/MIME the protocol is the protocol parameter of the multipart/encrypted
+// Content-Type, typically "application/pgp-encrypted".  A plain text body containing an
+// inline PGP message is reported with the protocol "inline-pgp".
+func (m *MIMEBody) IsEncrypted() (bool, string) {
+	mediatype, params, err := mime.ParseMediaType(m.header.Get("Content-Type"))
+	if err == nil && mediatype == "multipart/encrypted" {
+		return true, params["protocol"]
+	}
+	if strings.Contains(m.Text, pgpMessageBegin) {
+		return true, "inline-pgp"
+	}
+	return false, ""
+}
+
+// EncryptedContent returns the encrypted payload of the message so that it can be handed
+// off for decryption: the application/octet-stream part of a multipart/encrypted message,
+// or the armored block of an inline PGP message.  It returns nil if the message is not
+// encrypted.
+func (m *MIMEBody) EncryptedContent() []byte {
+	encrypted, protocol := m.IsEncrypted()
+	if !encrypted {
+		return nil
+	}
+	if protocol == "inline-pgp" {
+		start := strings.Index(m.Text, pgpMessageBegin)
+		end := strings.Index(m.Text[start:], pgpMessageEnd)
+		if end < 0 {
+			return []byte(m.Text[start:])
+		}
+		return []byte(m.Text[start : start+end+len(pgpMessageEnd)])
+	}
+	if m.Root == nil {
+		return nil
+	}
+	match := BreadthMatchFirst(m.Root, func(p MIMEPart) bool {
+		return p.Parent() == m.Root && p.ContentType() == "application/octet-stream"
+	})
+	if match == nil {
+		return nil
+	}
+	return match.Content()
+}
+
+// SigInfo describes a multipart/signed part (RFC 1847) for signature verification.
+type SigInfo struct {
+	Protocol  string   // protocol parameter, e.g. "application/pgp-signature"
+	MicAlg    string   // micalg parameter in lower case, e.g. "pgp-sha256" or "sha-256"
+	Signed    MIMEPart // First child, the content that was signed
+	Signature MIMEPart // Second child, the signature itself
+}
+
+// SignatureInfo locates the first multipart/signed part below root and returns its protocol
+// and message integrity check algorithm, along with its signed content and signature parts.
+// The signature part is typically application/pkcs7-signature for S/MIME or
+// application/pgp-signature for PGP/MIME.  ok is false if there is no multipart/signed part
+// or it does not have two children.
+func SignatureInfo(root MIMEPart) (info *SigInfo, ok bool) {
+	signed := BreadthMatchFirst(root, func(p MIMEPart) bool {
+		return p.ContentType() == "multipart/signed"
+	})
+	if signed == nil || signed.FirstChild() == nil || signed.FirstChild().NextSibling() == nil {
+		return nil, false
+	}
+	_, params, _ := parseMediaType(signed.Header().Get("Content-Type"))
+	return &SigInfo{
+		Protocol:  strings.ToLower(params["protocol"]),
+		MicAlg:    strings.ToLower(params["micalg"]),
+		Signed:    signed.FirstChild(),
+		Signature: signed.FirstChild().NextSibling(),
+	}, true
+}
+
+// InlineSignedText splits a clearsigned inline PGP message, such as the Text of a MIMEBody,
+// into the signed text and the armored signature block so that the signature can be
+// verified.  Armor headers (e.g. "Hash: SHA256") are skipped and dash-escaped lines have
+// their "- " prefix removed, recovering the text exactly as it was signed.  ok is false if
+// text does not contain a complete clearsigned message.
+func InlineSignedText(text string) (signed, signature string, ok bool) {
+	lines := strings.Split(text, "\n")
+	i := 0
+	for i < len(lines) && strings.TrimRight(lines[i], "\r") != pgpSignedBegin {
+		i++
+	}
+	// Skip armor headers, which end at the first blank line
+	for i++; i < len(lines) && strings.TrimRight(lines[i], "\r") != ""; i++ {
+	}
+	i++
+
+	var body []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimRight(line, "\r") == pgpSignatureBegin {
+			break
+		}
+		body = append(body, strings.TrimPrefix(line, "- "))
+	}
+	if i >= len(lines) {
+		return "", "", false
+	}
+
+	var sig []string
+	for ; i < len(lines); i++ {
+		sig = append(sig, lines[i])
+		if strings.TrimRight(lines[i], "\r") == pgpSignatureEnd {
+			// The line break before the signature block is not part of the signed text
+			signed = strings.TrimSuffix(strings.Join(body, "\n"), "\r")
+			return signed, strings.Join(sig, "\n"), true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,101 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestIsEncryptedPGPMIME(t *testing.T) {
+	msg := readMessage("pgp-mime.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	encrypted, protocol := mime.IsEncrypted()
+	assert.True(t, encrypted, "Message should be encrypted")
+	assert.Equal(t, protocol, "application/pgp-encrypted", "Protocol should be PGP")
+	content := string(mime.EncryptedContent())
+	assert.True(t, strings.HasPrefix(content, "-----BEGIN PGP MESSAGE-----"),
+		"Encrypted content should be the octet-stream part")
+}
+
+func TestIsEncryptedInline(t *testing.T) {
+	msg := readMessage("inline-pgp.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	encrypted, protocol := mime.IsEncrypted()
+	assert.True(t, encrypted, "Message should be encrypted")
+	assert.Equal(t, protocol, "inline-pgp", "Protocol should be inline PGP")
+	content := string(mime.EncryptedContent())
+	assert.True(t, strings.HasSuffix(content, "-----END PGP MESSAGE-----"),
+		"Encrypted content should end with the armor footer")
+}
+
+func TestIsEncryptedPlain(t *testing.T) {
+	msg := readMessage("attachment.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	encrypted, _ := mime.IsEncrypted()
+	assert.False(t, encrypted, "Message should not be encrypted")
+	assert.Nil(t, mime.EncryptedContent(), "Unencrypted message has no encrypted content")
+}
+
+func TestSignatureInfo(t *testing.T) {
+	msg := readMessage("pgp-signed.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Equal(t, mime.Text, "A signed text section", "Signed text should be the body")
+	info, ok := SignatureInfo(mime.Root)
+	if !assert.True(t, ok, "Message should be signed") {
+		t.FailNow()
+	}
+	assert.Equal(t, info.Protocol, "application/pgp-signature", "Protocol should be PGP")
+	assert.Equal(t, info.MicAlg, "pgp-sha256", "Micalg should be lower cased")
+	assert.Equal(t, info.Signed.ContentType(), "text/plain", "Expected the signed part")
+	assert.Equal(t, info.Signature.ContentType(), "application/pgp-signature",
+		"Expected the signature part")
+
+	msg = readMessage("pgp-mime.raw")
+	mime, err = ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	_, ok = SignatureInfo(mime.Root)
+	assert.False(t, ok, "Encrypted message is not signed")
+}
+
+func TestInlineSignedText(t *testing.T) {
+	msg := readMessage("inline-pgp-signed.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	signed, signature, ok := InlineSignedText(mime.Text)
+	assert.True(t, ok, "Should have found a clearsigned message")
+	assert.Equal(t, signed, "Hello Greg,\n-- not a signature delimiter\nRegards",
+		"Signed text should have armor headers and dash escapes removed")
+	assert.True(t, strings.HasPrefix(signature, "-----BEGIN PGP SIGNATURE-----"),
+		"Signature should start with the armor header")
+	assert.True(t, strings.HasSuffix(signature, "-----END PGP SIGNATURE-----"),
+		"Signature should end with the armor footer")
+}
+
+func TestInlineSignedTextMissing(t *testing.T) {
+	_, _, ok := InlineSignedText("Just some text")
+	assert.False(t, ok, "Plain text is not clearsigned")
+
+	_, _, ok = InlineSignedText("-----BEGIN PGP SIGNED MESSAGE-----\n\nTruncated")
+	assert.False(t, ok, "Truncated message has no signature")
+}
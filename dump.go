@@ -0,0 +1,31 @@
+package enmime
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// defaultDumpSize is the number of bytes dumped by HexDump when no positive maximum is given.
+const defaultDumpSize = 512
+
+// HexDump returns a hex.Dump style view of the first max bytes of the decoded content of the
+// part, for inspecting binary content in logs.  If max is not positive, up to 512 bytes are
+// dumped.  Truncated output ends with a line stating how many bytes were omitted.  The whole
+// content is obtained from Content, so a part deferred by Parser.DecodeBodyOnly is decoded in
+// full even though only its first bytes are shown.
+func HexDump(p MIMEPart, max int) string {
+	if max <= 0 {
+		max = defaultDumpSize
+	}
+	content := p.Content()
+	buf := new(bytes.Buffer)
+	dumper := hex.Dumper(buf)
+	io.Copy(dumper, io.LimitReader(bytes.NewReader(content), int64(max)))
+	dumper.Close()
+	if len(content) > max {
+		fmt.Fprintf(buf, "... %v more bytes\n", len(content)-max)
+	}
+	return buf.String()
+}
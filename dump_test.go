@@ -0,0 +1,24 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestHexDump(t *testing.T) {
+	p := &memMIMEPart{contentType: "application/octet-stream",
+		content: []byte("ABCDEFGHIJKLMNOPQR")}
+
+	dump := HexDump(p, 16)
+	assert.True(t, strings.HasPrefix(dump,
+		"00000000  41 42 43 44 45 46 47 48  49 4a 4b 4c 4d 4e 4f 50  |ABCDEFGHIJKLMNOP|\n"),
+		"Should dump the content, got %q", dump)
+	assert.True(t, strings.HasSuffix(dump, "... 2 more bytes\n"), "Should note the truncation")
+
+	dump = HexDump(p, 0)
+	assert.Contains(t, dump, "|QR|", "Default maximum should dump everything")
+	assert.NotContains(t, dump, "more bytes", "Complete dump should not note a truncation")
+
+	assert.Equal(t, HexDump(&memMIMEPart{}, 10), "", "Empty content should dump nothing")
+}
@@ -0,0 +1,124 @@
+package enmime
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"sort"
+	"strings"
+)
+
+// Encode writes the tree rooted at root to w as a MIME message, for proxies that re-emit a
+// message after modifying it, such as removing an attachment.  The output is streamed to w as
+// it is produced: boundaries and headers are written directly, and the content of each leaf
+// part is passed through a quoted-printable encoder for text parts, or a base64 encoder for
+// any other part, so the message is never held in memory a second time.
+//
+// Header fields are written in order of their canonical names, as the original order is not
+// kept.  The Content-Transfer-Encoding of each part is replaced, and the charset of text
+// converted to UTF-8 by the parser is set to utf-8.  Each multipart is given a boundary derived
+// from its PathIndex, such as =_enmime_1.2_=, which the encoded content cannot contain.
+// Multipart preambles and epilogues are dropped.
+func Encode(w io.Writer, root MIMEPart) error {
+	if root == nil {
+		return fmt.Errorf("Cannot encode a nil part")
+	}
+	bw := bufio.NewWriter(w)
+	if err := encodePart(bw, root); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// encodePart writes p and its descendants to w, see Encode.  Write errors are kept by the
+// bufio.Writer and reported by its Flush, so only encoder errors are returned here.
+func encodePart(w *bufio.Writer, p MIMEPart) error {
+	keys := make([]string, 0, len(p.Header()))
+	for key := range p.Header() {
+		if key != "Content-Type" && key != "Content-Transfer-Encoding" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range p.Header()[key] {
+			fmt.Fprintf(w, "%v: %v\r\n", key, value)
+		}
+	}
+
+	multipart := strings.HasPrefix(p.ContentType(), "multipart/")
+	boundary := ""
+	if multipart {
+		path := PathIndex(p)
+		if path == "" {
+			path = "0"
+		}
+		// Unlike the original boundary, this cannot appear in quoted-printable or base64
+		boundary = "=_enmime_" + path + "_="
+	}
+	if ctype := canonicalContentType(p, boundary); ctype != "" {
+		fmt.Fprintf(w, "Content-Type: %v\r\n", ctype)
+	}
+	if multipart {
+		w.WriteString("\r\n")
+		for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+			fmt.Fprintf(w, "--%v\r\n", boundary)
+			if err := encodePart(w, c); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(w, "--%v--\r\n", boundary)
+		return nil
+	}
+
+	var encoder io.WriteCloser
+	if strings.HasPrefix(p.ContentType(), "text/") {
+		w.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		encoder = quotedprintable.NewWriter(w)
+	} else {
+		w.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+		encoder = base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: w})
+	}
+	if _, err := encoder.Write(p.Content()); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	w.WriteString("\r\n")
+	return nil
+}
+
+// lineWrapper breaks the base64 text written to it into lines of canonicalLineLength
+// characters, ending each line but the last with CRLF.
+type lineWrapper struct {
+	w   io.Writer
+	col int // Characters written to the current line
+}
+
+// Write implements io.Writer.
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if l.col == canonicalLineLength {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return written, err
+			}
+			l.col = 0
+		}
+		n := canonicalLineLength - l.col
+		if n > len(p) {
+			n = len(p)
+		}
+		n, err := l.w.Write(p[:n])
+		written += n
+		l.col += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
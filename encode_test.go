@@ -0,0 +1,95 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/stretchrcom/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	root, err := ParseMIME(openPart("filename2231.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	buf := new(bytes.Buffer)
+	if !assert.Nil(t, Encode(buf, root), "Encoding should not have generated an error") {
+		t.FailNow()
+	}
+	encoded, err := ParseMIME(bufio.NewReader(bytes.NewReader(buf.Bytes())))
+	if !assert.Nil(t, err, "Parsing the encoded message should not have generated an error") {
+		t.FailNow()
+	}
+	want, got := root.FirstChild(), encoded.FirstChild()
+	for want != nil && got != nil {
+		assert.Equal(t, got.ContentType(), want.ContentType(), "Content type should be kept")
+		assert.Equal(t, got.FileName(), want.FileName(), "File name should be kept")
+		assert.Equal(t, string(got.Content()), string(want.Content()), "Content should be kept")
+		want, got = want.NextSibling(), got.NextSibling()
+	}
+	assert.Nil(t, want, "No part should be missing")
+	assert.Nil(t, got, "No part should be added")
+	assert.Contains(t, buf.String(), "Content-Type: text/plain; charset=utf-8\r\n",
+		"Converted text should be labeled utf-8")
+
+	// Content that was base64 encoded may hold a line matching the original boundary
+	raw := "Content-Type: multipart/mixed; boundary=\"b\"\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		"T25lDQotLWINClR3bw==\r\n" +
+		"--b--\r\n"
+	root, err = ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	buf.Reset()
+	if !assert.Nil(t, Encode(buf, root), "Encoding should not have generated an error") {
+		t.FailNow()
+	}
+	encoded, err = ParseMIME(bufio.NewReader(bytes.NewReader(buf.Bytes())))
+	if assert.Nil(t, err, "Parsing the encoded message should not have generated an error") {
+		assert.Equal(t, string(encoded.FirstChild().Content()), "One\r\n--b\r\nTwo",
+			"Content resembling the original boundary should be kept")
+		assert.Nil(t, encoded.FirstChild().NextSibling(), "No part should be added")
+	}
+
+	multipart := &memMIMEPart{contentType: "multipart/mixed"}
+	multipart.firstChild = &memMIMEPart{parent: multipart,
+		contentType: "application/octet-stream", content: bytes.Repeat([]byte{0xff}, 100)}
+	buf.Reset()
+	if !assert.Nil(t, Encode(buf, multipart), "Encoding should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Contains(t, buf.String(), "boundary=\"=_enmime_0_=\"", "Boundary should be generated")
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		assert.True(t, len(line) <= 76, "Base64 lines should be wrapped")
+	}
+}
+
+// benchmarkEncode encodes a message with an attachment of the given size, reporting the
+// allocations, which should not grow with the size of the attachment.
+func benchmarkEncode(b *testing.B, size int) {
+	root := &memMIMEPart{contentType: "multipart/mixed"}
+	text := &memMIMEPart{parent: root, contentType: "text/plain", content: []byte("Body\r\n")}
+	data := &memMIMEPart{parent: root, contentType: "application/octet-stream",
+		content: bytes.Repeat([]byte("attachment"), size/10)}
+	root.firstChild = text
+	text.nextSibling = data
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := Encode(ioutil.Discard, root); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncode1MB(b *testing.B) {
+	benchmarkEncode(b, 1<<20)
+}
+
+func BenchmarkEncode16MB(b *testing.B) {
+	benchmarkEncode(b, 16<<20)
+}
@@ -0,0 +1,35 @@
+package enmime
+
+import (
+	"fmt"
+)
+
+// Kinds of limit reported by LimitError
+const (
+	LimitTotalSize        = "total size"        // Parser.MaxTotalSize
+	LimitDecompressedSize = "decompressed size" // Parser.MaxDecompressedSize
+)
+
+// Error describes a problem with a message that the Parser recovered from in lenient mode, or
+// an action it took on the message such as dropping a disallowed attachment.
+type Error struct {
+	Name   string // Short description of the problem, e.g. "Size Limit Exceeded"
+	Detail string // Details about this occurrence of the problem
+	Offset int64  // Approximate byte offset into the message body where it was detected
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %v", e.Name, e.Detail)
+}
+
+// LimitError is returned when a message exceeds one of the limits configured on a Parser.
+type LimitError struct {
+	Kind  string // Which limit was exceeded, one of the Limit* constants
+	Limit int64  // The configured value of the limit
+}
+
+// Error implements the error interface.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("Message exceeds %v limit of %v bytes", e.Kind, e.Limit)
+}
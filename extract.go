@@ -0,0 +1,69 @@
+package enmime
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// ExtractAttachment streams through the message read from r to the first part named filename,
+// and returns a reader of its decoded content along with its content type, for serving a
+// single attachment from a large message.  No tree is built and no other part is decoded or
+// kept in memory.  The returned reader reads from r, so r must remain open until it has been
+// consumed; closing it does not close r.  File names are matched exactly, as returned by the
+// FileName method of a parsed part.  An error is returned if no part has the file name.
+func ExtractAttachment(r io.Reader, filename string) (io.ReadCloser, string, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	header, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		return nil, "", err
+	}
+	p := new(Parser)
+	body := p.reset(br)
+	content, ctype, err := p.extractPart(header, body, filename)
+	if err != nil {
+		return nil, "", err
+	}
+	if content == nil {
+		return nil, "", fmt.Errorf("Attachment %q not found", filename)
+	}
+	return ioutil.NopCloser(content), ctype, nil
+}
+
+// extractPart looks for the part named filename in the part with the given header and body,
+// descending into multiparts.  It returns a nil reader if the part is not found.
+func (p *Parser) extractPart(header textproto.MIMEHeader, body io.Reader,
+	filename string) (io.Reader, string, error) {
+	mediatype, mparams, err := parseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return nil, "", err
+	}
+	if !strings.HasPrefix(mediatype, "multipart/") {
+		_, dparams, _ := p.parseDisposition(header.Get("Content-Disposition"))
+		if fileName(header, mparams, dparams) != filename {
+			return nil, "", nil
+		}
+		return p.newDecoder(header.Get("Content-Transfer-Encoding"), body), mediatype, nil
+	}
+	mr := multipart.NewReader(body, mparams["boundary"])
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			return nil, "", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		content, ctype, err := p.extractPart(part.Header, part, filename)
+		if content != nil || err != nil {
+			return content, ctype, err
+		}
+	}
+}
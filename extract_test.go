@@ -0,0 +1,33 @@
+package enmime
+
+import (
+	"bytes"
+	"github.com/stretchrcom/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func TestExtractAttachment(t *testing.T) {
+	r, ctype, err := ExtractAttachment(bytes.NewReader(readRaw("renderable.raw")), "photo.jpg")
+	if !assert.Nil(t, err, "Extraction should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, ctype, "image/jpeg", "Expected the type of the attachment")
+	content, err := ioutil.ReadAll(r)
+	assert.Nil(t, err, "Reading should not have generated an error")
+	assert.Equal(t, content, []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10},
+		"Content should be decoded")
+	assert.Nil(t, r.Close(), "Closing should not have generated an error")
+
+	// Nested in a multipart/related
+	r, ctype, err = ExtractAttachment(bytes.NewReader(readRaw("renderable.raw")), "logo.png")
+	if !assert.Nil(t, err, "Extraction should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, ctype, "image/png", "Expected the type of the nested attachment")
+
+	_, _, err = ExtractAttachment(bytes.NewReader(readRaw("renderable.raw")), "missing.txt")
+	if assert.NotNil(t, err, "Missing attachment should generate an error") {
+		assert.Contains(t, err.Error(), "missing.txt", "Error should name the file")
+	}
+}
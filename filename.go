@@ -0,0 +1,81 @@
+package enmime
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// asciiTable holds transliterations for letters that do not decompose into an ASCII base
+// letter plus combining marks.
+var asciiTable = map[rune]string{
+	'Æ': "AE", 'æ': "ae", 'Ð': "D", 'ð': "d", 'Đ': "D", 'đ': "d", 'Ø': "O", 'ø': "o",
+	'Þ': "Th", 'þ': "th", 'ß': "ss", 'Ł': "L", 'ł': "l", 'Œ': "OE", 'œ': "oe", 'ı': "i",
+	'‘': "'", '’': "'", '“': "\"", '”': "\"", '–': "-", '—': "-",
+}
+
+// ASCIIFilename returns a copy of name containing only printable ASCII characters, for use on
+// systems that cannot handle Unicode file names.  Accented letters are folded to their base
+// letter (Müller.pdf becomes Muller.pdf), a few others are transliterated, and anything else
+// is dropped.  The extension is preserved; if nothing remains of the base name it is replaced
+// with "attachment".
+func ASCIIFilename(name string) string {
+	ext := asciiFold(path.Ext(name))
+	if ext == "." {
+		ext = ""
+	}
+	base := strings.TrimSpace(asciiFold(strings.TrimSuffix(name, path.Ext(name))))
+	if base == "" {
+		base = "attachment"
+	}
+	return base + ext
+}
+
+// asciiFold decomposes s and keeps only its printable ASCII characters, mapping letters found
+// in asciiTable to their transliterations.
+func asciiFold(s string) string {
+	buf := make([]byte, 0, len(s))
+	for _, r := range norm.NFKD.String(s) {
+		switch {
+		case r < utf8.RuneSelf:
+			if r >= ' ' && r != 0x7f {
+				buf = append(buf, byte(r))
+			}
+		case unicode.Is(unicode.Mn, r):
+			// Strip combining marks left behind by decomposition
+		default:
+			buf = append(buf, asciiTable[r]...)
+		}
+	}
+	return string(buf)
+}
+
+// TruncateFilename shortens name to at most max bytes for filesystems limiting the length of
+// file names, commonly to 255 bytes.  The base name is truncated and the extension preserved,
+// so photo.jpeg stays a JPEG; names are only cut between characters, never inside a multibyte
+// UTF-8 sequence.  If the extension alone does not fit, the whole name is truncated instead.
+// Names already short enough, and any name if max is not positive, are returned unchanged.
+func TruncateFilename(name string, max int) string {
+	if max <= 0 || len(name) <= max {
+		return name
+	}
+	ext := path.Ext(name)
+	if len(ext) >= max {
+		return truncateUTF8(name, max)
+	}
+	return truncateUTF8(strings.TrimSuffix(name, ext), max-len(ext)) + ext
+}
+
+// truncateUTF8 returns the longest prefix of s of at most max bytes that does not end in the
+// middle of a UTF-8 sequence.
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
@@ -0,0 +1,38 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestASCIIFilename(t *testing.T) {
+	assert.Equal(t, ASCIIFilename("Müller.pdf"), "Muller.pdf", "Accents should be folded")
+	assert.Equal(t, ASCIIFilename("Straße Æsir.txt"), "Strasse AEsir.txt",
+		"Non-decomposable letters should be transliterated")
+	assert.Equal(t, ASCIIFilename("plain.txt"), "plain.txt", "ASCII names should be unchanged")
+	assert.Equal(t, ASCIIFilename("日本語.doc"), "attachment.doc",
+		"Empty base name should be replaced, keeping extension")
+	assert.Equal(t, ASCIIFilename("report.日本"), "report", "Non-ASCII extension should be dropped")
+	assert.Equal(t, ASCIIFilename("ﬁle\x07.txt"), "file.txt",
+		"Compatibility characters should fold and controls should be dropped")
+}
+
+func TestTruncateFilename(t *testing.T) {
+	assert.Equal(t, TruncateFilename("report.pdf", 255), "report.pdf", "Short names are kept")
+	assert.Equal(t, TruncateFilename("annual report.pdf", 10), "annual.pdf",
+		"Base name should be truncated, keeping extension")
+	assert.Equal(t, TruncateFilename("report.pdf", 0), "report.pdf", "Zero max means no limit")
+
+	// Each character takes three bytes in UTF-8
+	long := strings.Repeat("日本語", 40) + ".txt"
+	truncated := TruncateFilename(long, 255)
+	assert.True(t, len(truncated) <= 255, "Name should fit, got %v bytes", len(truncated))
+	assert.True(t, utf8.ValidString(truncated), "Name should not be cut mid character")
+	assert.True(t, strings.HasSuffix(truncated, ".txt"), "Extension should be preserved")
+	assert.Equal(t, len(truncated), 83*3+len(".txt"), "Expected whole characters only")
+
+	assert.Equal(t, TruncateFilename("é.longextension", 5), "é.lo",
+		"Name should be truncated whole when the extension does not fit")
+}
@@ -0,0 +1,54 @@
+package enmime
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Fingerprint returns a hex encoded SHA-256 digest identifying the message rooted at root,
+// which stays the same when the message is seen again after passing through relays that add
+// or modify headers, for deduplication.  Only the following contribute to it:
+//
+//   - the Subject, normalized as described for MIMEBody.ThreadKey
+//   - the address of the From header, in lower case, without its display name
+//   - the Date header, converted to UTC
+//   - the decoded content of every part, in breadth first order
+//
+// All other headers, including volatile ones such as Received, DKIM-Signature and X-*, are
+// ignored, as is the transfer encoding of each part.
+func Fingerprint(root MIMEPart) string {
+	h := sha256.New()
+	writeField(h, normalizeSubject(DecodedHeader(root, "Subject")))
+
+	from := strings.TrimSpace(root.Header().Get("From"))
+	if addr, err := mail.ParseAddress(from); err == nil {
+		from = addr.Address
+	}
+	writeField(h, strings.ToLower(from))
+
+	date := strings.TrimSpace(root.Header().Get("Date"))
+	if t, err := mail.ParseDate(date); err == nil {
+		date = t.UTC().Format(time.RFC3339)
+	}
+	writeField(h, date)
+
+	BreadthMatchAll(root, func(p MIMEPart) bool {
+		writeField(h, string(p.Content()))
+		return false
+	})
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeField writes a length prefixed value to h, so that the boundaries between fields are
+// part of the digest.
+func writeField(h hash.Hash, value string) {
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(value)))
+	h.Write(size[:])
+	h.Write([]byte(value))
+}
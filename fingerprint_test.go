@@ -0,0 +1,48 @@
+package enmime
+
+import (
+	"bufio"
+	"github.com/stretchrcom/testify/assert"
+	"strings"
+	"testing"
+)
+
+func fingerprint(t *testing.T, raw string) string {
+	root, err := ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	return Fingerprint(root)
+}
+
+func TestFingerprint(t *testing.T) {
+	body := "Content-Type: multipart/alternative; boundary=\"Enmime-Fp\"\r\n" +
+		"\r\n" +
+		"--Enmime-Fp\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Hello there\r\n" +
+		"--Enmime-Fp\r\n" +
+		"Content-Type: text/html\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"PGI+SGVsbG88L2I+\r\n" +
+		"--Enmime-Fp--\r\n"
+	original := fingerprint(t, "From: James <james@example.com>\r\n"+
+		"Subject: Status\r\n"+
+		"Date: Sat, 13 Oct 2012 15:33:07 -0700\r\n"+body)
+	relayed := fingerprint(t, "Received: from relay.example.com by mx.example.net\r\n"+
+		"DKIM-Signature: v=1; d=example.com; b=abc\r\n"+
+		"X-Spam-Score: 0.1\r\n"+
+		"From: \"James H\" <JAMES@example.com>\r\n"+
+		"Subject: [list] Status\r\n"+
+		"Date: Sat, 13 Oct 2012 22:33:07 +0000\r\n"+body)
+	assert.Equal(t, relayed, original, "Relayed copy should have the same fingerprint")
+	assert.Equal(t, len(original), 64, "Fingerprint should be a hex encoded SHA-256")
+
+	edited := fingerprint(t, "From: James <james@example.com>\r\n"+
+		"Subject: Status\r\n"+
+		"Date: Sat, 13 Oct 2012 15:33:07 -0700\r\n"+
+		strings.Replace(body, "Hello there", "Hello here", 1))
+	assert.NotEqual(t, edited, original, "Different body should have a different fingerprint")
+}
@@ -0,0 +1,112 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/mail"
+)
+
+// DefaultMaxDecompressedSize is the number of bytes enmime will gunzip from a single stream
+// when Parser.MaxDecompressedSize is zero.
+const DefaultMaxDecompressedSize int64 = 128 << 20
+
+// ReadMIMEBodyMaybeGzip reads a message from r and parses its body with ParseMIMEBody.  If
+// the stream starts with the gzip magic bytes it is transparently decompressed first, as is
+// common for archived .eml.gz files.
+func ReadMIMEBodyMaybeGzip(r io.Reader) (*MIMEBody, error) {
+	return new(Parser).ReadMIMEBodyMaybeGzip(r)
+}
+
+// ReadMIMEBodyMaybeGzip reads a message from r, decompressing it like the package level
+// ReadMIMEBodyMaybeGzip, and parses its body using the options set on the Parser.
+func (p *Parser) ReadMIMEBodyMaybeGzip(r io.Reader) (*MIMEBody, error) {
+	br := bufio.NewReader(r)
+	reader := io.Reader(br)
+	if isGzip(br) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = p.decompressLimit(gz)
+	}
+
+	msg, err := mail.ReadMessage(reader)
+	if err != nil {
+		return nil, err
+	}
+	return p.ParseMIMEBody(msg)
+}
+
+// DecompressedContent returns the decoded content of the part, gunzipped if it starts with
+// the gzip magic bytes, e.g. an application/gzip or .gz attachment.  Other content is returned
+// unchanged.  Decompression is limited to DefaultMaxDecompressedSize bytes.
+func DecompressedContent(p MIMEPart) ([]byte, error) {
+	return new(Parser).DecompressedContent(p)
+}
+
+// DecompressedContent returns the content of part like the package level DecompressedContent,
+// limiting decompression to the MaxDecompressedSize of the Parser.
+func (p *Parser) DecompressedContent(part MIMEPart) ([]byte, error) {
+	content := part.Content()
+	if len(content) < 2 || content[0] != 0x1f || content[1] != 0x8b {
+		return content, nil
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return ioutil.ReadAll(p.decompressLimit(gz))
+}
+
+// decompressLimit limits the bytes read from the decompressor r to MaxDecompressedSize.
+func (p *Parser) decompressLimit(r io.Reader) io.Reader {
+	limit := p.MaxDecompressedSize
+	if limit == 0 {
+		limit = DefaultMaxDecompressedSize
+	}
+	return newSizeLimitReader(r, limit, LimitDecompressedSize)
+}
+
+// isGzip peeks at the start of br for the gzip magic bytes.
+func isGzip(br *bufio.Reader) bool {
+	magic, err := br.Peek(2)
+	return err == nil && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+// sizeLimitReader returns a LimitError once more than limit bytes have been read from the
+// underlying reader.
+type sizeLimitReader struct {
+	in        io.Reader
+	remaining int64
+	kind      string
+	limit     int64
+}
+
+// newSizeLimitReader returns a sizeLimitReader reporting LimitErrors of the given kind.
+func newSizeLimitReader(r io.Reader, limit int64, kind string) *sizeLimitReader {
+	return &sizeLimitReader{in: r, remaining: limit, kind: kind, limit: limit}
+}
+
+// Read method for io.Reader interface.
+func (l *sizeLimitReader) Read(p []byte) (n int, err error) {
+	if l.remaining <= 0 {
+		// Only an error if there is actually more data
+		var b [1]byte
+		n, err = l.in.Read(b[:])
+		if n > 0 {
+			return 0, &LimitError{Kind: l.kind, Limit: l.limit}
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err = l.in.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,74 @@
+package enmime
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchrcom/testify/assert"
+	"testing"
+)
+
+func TestReadMIMEBodyMaybeGzip(t *testing.T) {
+	raw := readRaw("attachment.raw")
+	gzipped := new(bytes.Buffer)
+	gz := gzip.NewWriter(gzipped)
+	gz.Write(raw)
+	gz.Close()
+
+	mime, err := ReadMIMEBodyMaybeGzip(gzipped)
+	if !assert.Nil(t, err, "Parsing gzipped message should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Contains(t, mime.Text, "A text section")
+	assert.Equal(t, len(mime.Attachments), 1, "Should have a single attachment")
+
+	mime, err = ReadMIMEBodyMaybeGzip(bytes.NewReader(raw))
+	if !assert.Nil(t, err, "Parsing plain message should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Contains(t, mime.Text, "A text section")
+}
+
+func TestReadMIMEBodyMaybeGzipLimit(t *testing.T) {
+	gzipped := new(bytes.Buffer)
+	gz := gzip.NewWriter(gzipped)
+	gz.Write([]byte("Subject: bomb\r\n\r\n"))
+	gz.Write(make([]byte, 4096))
+	gz.Close()
+
+	p := &Parser{MaxDecompressedSize: 1024}
+	_, err := p.ReadMIMEBodyMaybeGzip(gzipped)
+	_, ok := err.(*LimitError)
+	assert.True(t, ok, "Exceeding decompressed size should generate a LimitError")
+}
+
+func TestDecompressedContent(t *testing.T) {
+	gzipped := new(bytes.Buffer)
+	gz := gzip.NewWriter(gzipped)
+	gz.Write([]byte("log line 1\nlog line 2\n"))
+	gz.Close()
+
+	p := &memMIMEPart{contentType: "application/gzip", content: gzipped.Bytes()}
+	content, err := DecompressedContent(p)
+	if !assert.Nil(t, err, "Decompressing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(content), "log line 1\nlog line 2\n", "Content should be decompressed")
+
+	p = &memMIMEPart{contentType: "text/plain", content: []byte("not compressed")}
+	content, err = DecompressedContent(p)
+	assert.Nil(t, err, "Plain content should not generate an error")
+	assert.Equal(t, string(content), "not compressed", "Plain content should be unchanged")
+}
+
+func TestDecompressedContentLimit(t *testing.T) {
+	gzipped := new(bytes.Buffer)
+	gz := gzip.NewWriter(gzipped)
+	gz.Write(make([]byte, 4096))
+	gz.Close()
+
+	p := &Parser{MaxDecompressedSize: 1024}
+	part := &memMIMEPart{contentType: "application/gzip", content: gzipped.Bytes()}
+	_, err := p.DecompressedContent(part)
+	_, ok := err.(*LimitError)
+	assert.True(t, ok, "Exceeding decompressed size should generate a LimitError")
+}
@@ -0,0 +1,222 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ReadHeaders reads only the header block of a message from r, which is much cheaper than a
+// full parse when just the top-level headers are needed.  If r is a *bufio.Reader it is
+// left positioned at the start of the body, just after the blank line ending the headers;
+// any other reader is buffered, so its position afterwards is unspecified.  Use DecodeHeader
+// to decode the values of headers such as Subject.
+func ReadHeaders(r io.Reader) (textproto.MIMEHeader, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return textproto.NewReader(br).ReadMIMEHeader()
+}
+
+// ParseHeaderBlock parses a standalone block of RFC 822 style header fields, such as the body
+// of a text/rfc822-headers part returned in a delivery status notification, or of a
+// message/disposition-notification part.  Leading blank lines are skipped and the closing
+// blank line is optional.  The block ends at the first blank line, or the first line that is
+// neither a header field nor a continuation line; any content after it is ignored.
+func ParseHeaderBlock(data []byte) (textproto.MIMEHeader, error) {
+	data = bytes.TrimLeft(data, "\r\n")
+	end := 0
+	for end < len(data) {
+		next := bytes.IndexByte(data[end:], '\n') + 1
+		if next == 0 {
+			next = len(data) - end
+		}
+		line := bytes.TrimRight(data[end:end+next], "\r\n")
+		continuation := len(line) > 0 && (line[0] == ' ' || line[0] == '\t')
+		if !headerField.Match(line) && (end == 0 || !continuation) {
+			break
+		}
+		end += next
+	}
+	r := io.MultiReader(bytes.NewReader(data[:end]), strings.NewReader("\r\n\r\n"))
+	return textproto.NewReader(bufio.NewReader(r)).ReadMIMEHeader()
+}
+
+// RewriteHeader copies the message read from r to w with the top-level header field key set
+// to value, for proxies that mark messages before forwarding them.  If the field is present its
+// first occurrence is replaced in place and any others are removed, otherwise the field is
+// added at the end of the header.  Only the header is parsed: the rest of the header and the
+// body are copied exactly, so signatures over the body remain valid.  The new field uses the
+// line ending of the first header line, and a value that is not ASCII is written as RFC 2047
+// encoded-words.
+func RewriteHeader(r io.Reader, w io.Writer, key, value string) error {
+	br := bufio.NewReader(r)
+	name := []byte(textproto.CanonicalMIMEHeaderKey(key) + ":")
+	var header bytes.Buffer
+	newline := "\r\n"
+	replaced, skipping := false, false
+	field := func() []byte {
+		return []byte(string(name) + " " + mime.QEncoding.Encode("utf-8", value) + newline)
+	}
+	for first := true; ; first = false {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if first && bytes.HasSuffix(line, []byte("\n")) && !bytes.HasSuffix(line, []byte("\r\n")) {
+			newline = "\n"
+		}
+		end := len(bytes.TrimRight(line, "\r\n")) == 0
+		if end && !replaced {
+			header.Write(field())
+		}
+		if end {
+			header.Write(line)
+			break
+		}
+		continuation := line[0] == ' ' || line[0] == '\t'
+		if !continuation {
+			skipping = len(line) >= len(name) && bytes.EqualFold(line[:len(name)], name)
+			if skipping && !replaced {
+				header.Write(field())
+				replaced = true
+			}
+		}
+		if !skipping {
+			header.Write(line)
+		}
+		if err == io.EOF {
+			// Message without a body
+			if !replaced {
+				if !bytes.HasSuffix(line, []byte("\n")) {
+					header.WriteString(newline)
+				}
+				header.Write(field())
+			}
+			break
+		}
+	}
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, br)
+	return err
+}
+
+// headerField matches the start of a header field line, a field name followed by a colon.
+var headerField = regexp.MustCompile(`^[\x21-\x39\x3b-\x7e]+:`)
+
+// looksLikeHeaders returns true if data, ignoring surrounding blank lines, consists entirely of
+// header fields and their continuation lines.
+func looksLikeHeaders(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return false
+	}
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		continuation := len(line) > 0 && (line[0] == ' ' || line[0] == '\t')
+		if !headerField.Match(line) && (i == 0 || !continuation) {
+			return false
+		}
+	}
+	return true
+}
+
+// encodedWord matches a single RFC 2047 encoded-word.
+var encodedWord = regexp.MustCompile(`=\?[^?\s]+\?[bBqQ]\?[^?\s]*\?=`)
+
+// DecodeHeader decodes any RFC 2047 encoded-words in a header value, returning UTF-8.  Both
+// the B and Q encodings are supported, and the whitespace between adjacent encoded-words is
+// removed as the RFC requires.  Encoded-words that cannot be decoded, because their charset is
+// unknown or their encoded text is malformed, are left as they are.
+func DecodeHeader(value string) string {
+	dec := &mime.WordDecoder{CharsetReader: charsetReader}
+	decoded, err := dec.DecodeHeader(value)
+	if err == nil {
+		return decoded
+	}
+
+	// Decode word by word, so that a single bad word does not prevent decoding the others
+	buf := new(bytes.Buffer)
+	last := 0
+	prevDecoded := false
+	for _, loc := range encodedWord.FindAllStringIndex(value, -1) {
+		word := value[loc[0]:loc[1]]
+		text, err := dec.Decode(word)
+		between := value[last:loc[0]]
+		if !(prevDecoded && err == nil && strings.TrimSpace(between) == "") {
+			buf.WriteString(between)
+		}
+		if err != nil {
+			text = word
+		}
+		buf.WriteString(text)
+		last = loc[1]
+		prevDecoded = err == nil
+	}
+	buf.WriteString(value[last:])
+	return buf.String()
+}
+
+// DecodedHeader returns the first value of the named header of the part, with any RFC 2047
+// encoded-words decoded to UTF-8 by DecodeHeader.  It returns "" if there is no such header.
+func DecodedHeader(p MIMEPart, key string) string {
+	return DecodeHeader(p.Header().Get(key))
+}
+
+// HeaderNames returns the canonical names of all the headers of the part, each listed once, for
+// displaying every header without knowing the keys in advance.  The order of the headers in the
+// message is not kept by the parser, so the names are sorted.
+func HeaderNames(p MIMEPart) []string {
+	names := make([]string, 0, len(p.Header()))
+	for key := range p.Header() {
+		names = append(names, textproto.CanonicalMIMEHeaderKey(key))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// charsetReader returns a reader that converts input from charset to UTF-8.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	decoder, err := charsetDecoder(charset)
+	if err != nil {
+		return nil, err
+	}
+	if decoder == nil {
+		return input, nil
+	}
+	return decoder.Reader(input), nil
+}
+
+// Languages returns the language tags (BCP 47, e.g. "en-US") declared by the Content-Language
+// headers of the message and of each of its parts, in the order first encountered.  A header
+// may list several comma separated tags; duplicates are returned once.
+func (m *MIMEBody) Languages() []string {
+	var langs []string
+	seen := make(map[string]bool)
+	add := func(value string) {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag != "" && !seen[strings.ToLower(tag)] {
+				seen[strings.ToLower(tag)] = true
+				langs = append(langs, tag)
+			}
+		}
+	}
+
+	add(m.header.Get("Content-Language"))
+	if m.Root != nil {
+		BreadthMatchAll(m.Root, func(p MIMEPart) bool {
+			add(p.Header().Get("Content-Language"))
+			return false
+		})
+	}
+	return langs
+}
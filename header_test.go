@@ -0,0 +1,146 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/stretchrcom/testify/assert"
+	"io/ioutil"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestReadHeaders(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("From: James <james@makita.skynet>\r\n" +
+		"Subject: =?ISO-8859-1?Q?Fran=E7ois?=\r\n\r\nBody text\r\n"))
+	header, err := ReadHeaders(r)
+
+	if !assert.Nil(t, err, "Reading headers should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, header.Get("From"), "James <james@makita.skynet>", "From should be read")
+	assert.Equal(t, DecodeHeader(header.Get("Subject")), "François", "Subject should be decoded")
+	body, _ := ioutil.ReadAll(r)
+	assert.Equal(t, string(body), "Body text\r\n", "Reader should be positioned at the body")
+}
+
+func TestDecodeHeader(t *testing.T) {
+	assert.Equal(t, DecodeHeader("=?UTF-8?B?4piDIGhlbGxv?="), "☃ hello", "Should decode B encoding")
+	assert.Equal(t, DecodeHeader("plain text"), "plain text", "Plain text should be unchanged")
+	assert.Equal(t, DecodeHeader("=?x-bogus?Q?abc?="), "=?x-bogus?Q?abc?=",
+		"Unknown charset should be left encoded")
+}
+
+func TestLanguages(t *testing.T) {
+	msg, err := mail.ReadMessage(strings.NewReader("Content-Language: en-US, de\r\n" +
+		"Content-Type: multipart/alternative; boundary=\"Enmime-Test-100\"\r\n\r\n" +
+		"--Enmime-Test-100\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Language: fr, en-us\r\n\r\n" +
+		"Bonjour\r\n" +
+		"--Enmime-Test-100--\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Equal(t, mime.Languages(), []string{"en-US", "de", "fr"},
+		"Should have deduplicated languages from message and parts")
+}
+
+func TestLanguagesNone(t *testing.T) {
+	msg := readMessage("attachment.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Equal(t, len(mime.Languages()), 0, "Should have no languages")
+}
+
+func TestDecodeHeaderEdgeCases(t *testing.T) {
+	assert.Equal(t, DecodeHeader("=?ISO-8859-1?Q?Fran=E7ois?= <f@example.com>"),
+		"François <f@example.com>", "Should decode Q encoding mixed with plain text")
+	assert.Equal(t, DecodeHeader("=?UTF-8?Q?a?= \t =?UTF-8?Q?b?= c"), "ab c",
+		"Whitespace between adjacent encoded-words should be removed")
+	assert.Equal(t, DecodeHeader("=?x-bogus?Q?abc?= =?UTF-8?B?4piD?= ok"),
+		"=?x-bogus?Q?abc?= ☃ ok", "Only the word with an unknown charset should be kept")
+	assert.Equal(t, DecodeHeader("=?UTF-8?B?!!!?= =?windows-1252?Q?=80?="),
+		"=?UTF-8?B?!!!?= €", "Malformed word should be kept")
+}
+
+func TestDecodedHeader(t *testing.T) {
+	p := &memMIMEPart{header: textproto.MIMEHeader{
+		"Subject": {"=?UTF-8?B?4piDIGhlbGxv?= =?UTF-8?Q?_world?="}}}
+	assert.Equal(t, DecodedHeader(p, "Subject"), "☃ hello world", "Subject should be decoded")
+	assert.Equal(t, DecodedHeader(p, "To"), "", "Missing header should be empty")
+}
+
+func TestHeaderNames(t *testing.T) {
+	root, err := ParseMIME(openPart("multibase64.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, HeaderNames(root), []string{"Content-Type"}, "Expected the root header")
+	assert.Equal(t, HeaderNames(root.FirstChild().NextSibling()),
+		[]string{"Content-Disposition", "Content-Transfer-Encoding", "Content-Type"},
+		"Names should be sorted")
+
+	p := &memMIMEPart{header: textproto.MIMEHeader{}}
+	assert.Equal(t, HeaderNames(p), []string{}, "No headers should give an empty list")
+}
+
+func TestParseHeaderBlock(t *testing.T) {
+	header, err := ParseHeaderBlock([]byte("\r\nFrom: james@example.com\r\n" +
+		"Subject: Folded\r\n subject\r\nTo: greg@example.com"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, header.Get("From"), "james@example.com", "Expected From header")
+	assert.Equal(t, header.Get("Subject"), "Folded subject", "Folded header should be joined")
+	assert.Equal(t, header.Get("To"), "greg@example.com", "Last line needs no line break")
+
+	header, err = ParseHeaderBlock([]byte("Subject: Returned\r\n\r\nNot: a header\r\n"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, len(header), 1, "Content after the blank line should be ignored")
+
+	header, err = ParseHeaderBlock([]byte("Subject: Truncated\nthe rest of the body\n"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, header.Get("Subject"), "Truncated", "Header before the content is kept")
+	assert.Equal(t, len(header), 1, "Trailing content should be ignored")
+}
+
+func TestRewriteHeader(t *testing.T) {
+	raw := "From: james@example.com\r\nX-Scanned: no\r\n  folded\r\nSubject: Hi\r\n" +
+		"x-scanned: again\r\n\r\nBody =\r\nbytes\r\n"
+	out := new(bytes.Buffer)
+	err := RewriteHeader(strings.NewReader(raw), out, "x-scanned", "yes")
+	if !assert.Nil(t, err, "Rewriting should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, out.String(), "From: james@example.com\r\nX-Scanned: yes\r\nSubject: Hi\r\n"+
+		"\r\nBody =\r\nbytes\r\n", "Field should be replaced in place, body kept exactly")
+
+	out.Reset()
+	err = RewriteHeader(strings.NewReader("From: a@b\nSubject: Hi\n\nBody"), out, "X-Note",
+		"café")
+	if !assert.Nil(t, err, "Rewriting should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, out.String(), "From: a@b\nSubject: Hi\nX-Note: =?utf-8?q?caf=C3=A9?=\n\nBody",
+		"Field should be added with the message line ending")
+
+	out.Reset()
+	err = RewriteHeader(strings.NewReader("Subject: Hi"), out, "X-Scanned", "yes")
+	assert.Nil(t, err, "Rewriting should not have generated an error")
+	assert.Equal(t, out.String(), "Subject: Hi\r\nX-Scanned: yes\r\n",
+		"Field should be added to a message without a body")
+}
@@ -0,0 +1,310 @@
+package enmime
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	cidRef     = regexp.MustCompile(`(?i)cid:([^"'\s>)]+)`)
+	spaceRun   = regexp.MustCompile(`[ \t\r\f\v]+`)
+	lineSpace  = regexp.MustCompile(` ?\n ?`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText converts the HTML portion of the message into lightweight plain text suitable
+// for previews.  It is not a full renderer, but it preserves some structure:
+//
+//   - headings, paragraphs and other block elements are separated by blank lines
+//   - list items are placed on their own line and prefixed with "- "
+//   - links are written as "text (url)" unless the text is already the url
+//   - <br> starts a new line
+//   - script, style and head content is dropped
+func (m *MIMEBody) HTMLToText() string {
+	return htmlToText(m.Html)
+}
+
+// htmlToText implements HTMLToText for an arbitrary HTML string.
+func htmlToText(s string) string {
+	buf := new(bytes.Buffer)
+	skip := 0
+	type link struct {
+		href  string
+		start int
+	}
+	var links []link
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		tok := z.Token()
+		switch tt {
+		case html.TextToken:
+			if skip == 0 {
+				buf.WriteString(spaceRun.ReplaceAllString(strings.Replace(tok.Data, "\n", " ", -1), " "))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch tok.DataAtom {
+			case atom.Script, atom.Style, atom.Head, atom.Title:
+				if tt == html.StartTagToken {
+					skip++
+				}
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.P, atom.Div,
+				atom.Blockquote, atom.Table, atom.Ul, atom.Ol, atom.Hr, atom.Pre:
+				buf.WriteString("\n\n")
+			case atom.Tr:
+				buf.WriteString("\n")
+			case atom.Li:
+				buf.WriteString("\n- ")
+			case atom.Br:
+				buf.WriteString("\n")
+			case atom.A:
+				href := ""
+				for _, a := range tok.Attr {
+					if a.Key == "href" {
+						href = strings.TrimSpace(a.Val)
+					}
+				}
+				links = append(links, link{href, buf.Len()})
+			}
+		case html.EndTagToken:
+			switch tok.DataAtom {
+			case atom.Script, atom.Style, atom.Head, atom.Title:
+				if skip > 0 {
+					skip--
+				}
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.P, atom.Div,
+				atom.Blockquote, atom.Table, atom.Ul, atom.Ol, atom.Pre:
+				buf.WriteString("\n\n")
+			case atom.A:
+				if len(links) == 0 {
+					break
+				}
+				l := links[len(links)-1]
+				links = links[:len(links)-1]
+				text := strings.TrimSpace(string(buf.Bytes()[l.start:]))
+				if l.href != "" && text != l.href && "mailto:"+text != l.href {
+					buf.WriteString(" (" + l.href + ")")
+				}
+			}
+		}
+	}
+
+	text := spaceRun.ReplaceAllString(buf.String(), " ")
+	text = lineSpace.ReplaceAllString(text, "\n")
+	text = blankLines.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// RewriteCIDs returns the HTML portion of the message with each cid: reference to an inline
+// part replaced by the URL returned from urlFor, which is passed the Content-ID without its
+// angle brackets.  This lets a web viewer serve inline images at their own URLs rather than
+// embedding them.  References that do not match any part's Content-ID are left unchanged.
+func (m *MIMEBody) RewriteCIDs(urlFor func(contentID string) string) (html string, err error) {
+	if m.Root == nil {
+		return m.Html, nil
+	}
+	known := make(map[string]bool)
+	BreadthMatchAll(m.Root, func(p MIMEPart) bool {
+		if id := contentID(p); id != "" {
+			known[id] = true
+		}
+		return false
+	})
+
+	html = cidRef.ReplaceAllStringFunc(m.Html, func(ref string) string {
+		id := ref[len("cid:"):]
+		if !known[id] {
+			return ref
+		}
+		return urlFor(id)
+	})
+	return html, nil
+}
+
+// unsafeElements are removed from sanitized HTML along with their content.
+var unsafeElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Iframe: true, atom.Frame: true, atom.Frameset: true,
+	atom.Object: true, atom.Embed: true, atom.Applet: true, atom.Noscript: true,
+}
+
+// voidElements have no content or end tag, so removing them does not skip what follows.
+var voidElements = map[atom.Atom]bool{atom.Embed: true, atom.Frame: true}
+
+// unsafeTags are removed from sanitized HTML, keeping their content.
+var unsafeTags = map[atom.Atom]bool{
+	atom.Base: true, atom.Link: true, atom.Meta: true, atom.Form: true,
+}
+
+// urlAttrs are the attributes holding a URL.
+var urlAttrs = map[string]bool{
+	"href": true, "src": true, "action": true, "formaction": true, "background": true,
+	"poster": true, "xlink:href": true, "srcset": true, "lowsrc": true, "dynsrc": true,
+}
+
+// unsafeCSS matches style content that runs script or loads a resource.  Any backslash is
+// matched as well, since CSS escapes such as u\72l( would otherwise hide the function names.
+var unsafeCSS = regexp.MustCompile(
+	`(?i)expression\s*\(|@import|url\s*\(\s*['"]?\s*(?:https?:|//|javascript:)|\\`)
+
+// SanitizedHTML returns the HTML portion of the message made safe for display in a mail
+// viewer.  It removes:
+//
+//   - script, iframe, frame, object, embed, applet and noscript elements with their content
+//   - base, link, meta and form tags, keeping any content
+//   - comments, which some clients interpret as conditional markup
+//   - event handler attributes such as onclick or onload
+//   - URLs using the javascript:, vbscript: or data: schemes, except data: images
+//   - resources loaded automatically from remote servers, such as <img src="http://...">,
+//     which reveal to the sender that the message was read; links are kept
+//   - style elements and attributes that load remote resources or run script
+//
+// References to inline parts with cid: URLs are kept, and may then be rewritten like
+// RewriteCIDs does.  An error is returned if the HTML cannot be tokenized.
+func (m *MIMEBody) SanitizedHTML() (string, error) {
+	return sanitizeHTML(m.Html)
+}
+
+// sanitizeHTML implements SanitizedHTML for an arbitrary HTML string.
+func sanitizeHTML(s string) (string, error) {
+	buf := new(bytes.Buffer)
+	skip := 0
+	style := false // Within a style element
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return buf.String(), nil
+			}
+			return "", z.Err()
+		}
+		raw := string(z.Raw())
+		tok := z.Token()
+		switch tt {
+		case html.TextToken:
+			switch {
+			case skip > 0:
+			case style:
+				// Only CSS is written raw, as other raw text would be markup once the
+				// element around it is removed
+				if !unsafeCSS.MatchString(raw) {
+					buf.WriteString(raw)
+				}
+			default:
+				buf.WriteString(html.EscapeString(tok.Data))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			// Browsers ignore the slash of <style/> or <script/>, so the content that follows
+			// belongs to the element all the same
+			style = tok.DataAtom == atom.Style
+			if unsafeElements[tok.DataAtom] {
+				if !voidElements[tok.DataAtom] {
+					skip++
+				}
+				continue
+			}
+			if skip == 0 && !unsafeTags[tok.DataAtom] {
+				tok.Attr = safeAttrs(tok)
+				buf.WriteString(tok.String())
+			}
+		case html.EndTagToken:
+			style = false
+			if unsafeElements[tok.DataAtom] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip == 0 && !unsafeTags[tok.DataAtom] {
+				buf.WriteString(tok.String())
+			}
+		case html.DoctypeToken:
+			buf.WriteString(raw)
+		}
+	}
+}
+
+// safeAttrs returns the attributes of tok that are safe to keep, see SanitizedHTML.
+func safeAttrs(tok html.Token) []html.Attribute {
+	var attrs []html.Attribute
+	for _, a := range tok.Attr {
+		key := strings.ToLower(a.Key)
+		if strings.HasPrefix(key, "on") {
+			continue
+		}
+		if key == "style" && unsafeCSS.MatchString(a.Val) {
+			continue
+		}
+		if key == "srcset" && !safeSrcset(tok.DataAtom, a.Val) {
+			continue
+		}
+		if urlAttrs[key] && key != "srcset" && !safeURL(tok.DataAtom, key, a.Val) {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	return attrs
+}
+
+// safeURL returns true if the URL value of the attribute key may be kept: links may point
+// anywhere but to script, while other URLs are loaded automatically and must refer to inline
+// content.
+func safeURL(element atom.Atom, key, value string) bool {
+	// Browsers ignore control characters and whitespace anywhere in the scheme
+	value = strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= 0x20 {
+			return -1
+		}
+		return r
+	}, value))
+	switch {
+	case strings.HasPrefix(value, "javascript:"), strings.HasPrefix(value, "vbscript:"):
+		return false
+	case strings.HasPrefix(value, "data:"):
+		return element == atom.Img && strings.HasPrefix(value, "data:image/")
+	case key == "href" && (element == atom.A || element == atom.Area):
+		return true
+	}
+	return strings.HasPrefix(value, "cid:") || !strings.Contains(value, ":") &&
+		!strings.HasPrefix(value, "//")
+}
+
+// safeSrcset returns true if every image candidate of a srcset value is a URL that may be
+// kept, see safeURL.  Each candidate is a URL, optionally followed by descriptors such as 2x,
+// and candidates are separated by commas.
+func safeSrcset(element atom.Atom, value string) bool {
+	for value != "" {
+		value = strings.TrimLeft(value, " \t\r\n\f,")
+		end := strings.IndexAny(value, " \t\r\n\f")
+		if end < 0 {
+			end = len(value)
+		}
+		url := value[:end]
+		value = value[end:]
+		if strings.HasSuffix(url, ",") {
+			url = strings.TrimRight(url, ",")
+		} else if comma := strings.IndexByte(value, ','); comma >= 0 {
+			value = value[comma+1:]
+		} else {
+			value = ""
+		}
+		if url != "" && !safeURL(element, "srcset", url) {
+			return false
+		}
+	}
+	return true
+}
+
+// contentID returns the Content-ID of the part with its angle brackets removed.
+func contentID(p MIMEPart) string {
+	id := strings.TrimSpace(p.Header().Get("Content-Id"))
+	return strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">")
+}
@@ -0,0 +1,125 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"golang.org/x/net/html/atom"
+	"testing"
+)
+
+func TestHTMLToText(t *testing.T) {
+	mime := &MIMEBody{Html: `<html><head><title>Ignored</title>
+<style>p { color: red; }</style></head>
+<body><h1>Heading</h1><p>First   paragraph
+wraps.</p><p>See <a href="http://example.com/">the site</a> or
+<a href="http://example.com/">http://example.com/</a>.</p>
+<ul><li>One</li><li>Two</li></ul>Line<br>Break<script>alert("x")</script></body></html>`}
+
+	assert.Equal(t, mime.HTMLToText(), "Heading\n\nFirst paragraph wraps.\n\n"+
+		"See the site (http://example.com/) or http://example.com/.\n\n"+
+		"- One\n- Two\n\nLine\nBreak")
+}
+
+func TestHTMLToTextInline(t *testing.T) {
+	msg := readMessage("html-mime-inline.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Equal(t, mime.HTMLToText(), "Test of HTML section")
+}
+
+func TestRewriteCIDs(t *testing.T) {
+	msg := readMessage("html-mime-inline.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	mime.Html += `<img src="cid:unknown@skynet">`
+
+	html, err := mime.RewriteCIDs(func(id string) string {
+		return "/parts/" + id
+	})
+	if !assert.Nil(t, err, "Rewriting should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Contains(t, html, `src="/parts/8B8481A2-25CA-4886-9B5A-8EB9115DD064@skynet"`,
+		"Known cid should be rewritten")
+	assert.Contains(t, html, `src="cid:unknown@skynet"`, "Unknown cid should be unchanged")
+}
+
+func TestSanitizedHTML(t *testing.T) {
+	mime := &MIMEBody{Html: `<html><head><style>p > b { color: red; }</style>` +
+		`<style>body { background: url("http://tracker.example.com/bg.png"); }</style>` +
+		`<script>alert("x")</script></head>` +
+		`<body onload="track()"><p onclick="steal()">Hello <b>world</b></p>` +
+		`<a href="https://example.com/?a=1&amp;b=2">link</a> <a href="javascript:steal()">bad</a>` +
+		`<img src="cid:logo@example.com"><img src="http://tracker.example.com/pixel.gif">` +
+		`<img src="data:image/png;base64,iVBORw0KGgo="><!-- comment -->` +
+		`<iframe src="http://example.com/"><p>hidden</p></iframe>` +
+		`<form action="http://example.com/"><input name="q"></form>` +
+		`<span style="width: expression(alert(1))">styled</span></body></html>`}
+
+	html, err := mime.SanitizedHTML()
+	if !assert.Nil(t, err, "Sanitizing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, html, `<html><head><style>p > b { color: red; }</style><style></style>`+
+		`</head><body><p>Hello <b>world</b></p>`+
+		`<a href="https://example.com/?a=1&amp;b=2">link</a> <a>bad</a>`+
+		`<img src="cid:logo@example.com"><img>`+
+		`<img src="data:image/png;base64,iVBORw0KGgo=">`+
+		`<input name="q"><span>styled</span></body></html>`, "Unexpected sanitized HTML")
+}
+
+func TestSanitizedHTMLEvasions(t *testing.T) {
+	mime := &MIMEBody{Html: `<style/>@import url(http://evil.example.com/x.css);</style>` +
+		`<a href="&#1;javascript:alert(1)">ctl</a><a href="java&#9;script:alert(1)">tab</a>` +
+		`<img src=" &#10;http://tracker.example.com/pixel.gif">`}
+	html, err := mime.SanitizedHTML()
+	if !assert.Nil(t, err, "Sanitizing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.NotContains(t, html, "@import", "Self-closing style should still be filtered")
+	assert.NotContains(t, html, "script:", "Control characters should not hide the scheme")
+	assert.NotContains(t, html, "tracker", "Whitespace should not hide the remote URL")
+
+	assert.False(t, safeURL(atom.A, "href", "\x01javascript:alert(1)"),
+		"Leading control character should be ignored")
+	assert.False(t, safeURL(atom.A, "href", "java\tscript:alert(1)"),
+		"Tab inside the scheme should be ignored")
+}
+
+func TestSanitizedHTMLRawText(t *testing.T) {
+	for _, tag := range []string{"script", "iframe", "noscript"} {
+		mime := &MIMEBody{Html: "<" + tag + "/><img src=x onerror=alert(1)></" + tag + ">ok"}
+		html, err := mime.SanitizedHTML()
+		if !assert.Nil(t, err, "Sanitizing should not have generated an error") {
+			t.FailNow()
+		}
+		assert.Equal(t, html, "ok", "Self-closing "+tag+" should be removed with its content")
+	}
+
+	// Raw text of an element kept by the sanitizer is escaped
+	mime := &MIMEBody{Html: "<xmp><img src=x onerror=alert(1)></xmp>"}
+	html, err := mime.SanitizedHTML()
+	if !assert.Nil(t, err, "Sanitizing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, html, "<xmp>&lt;img src=x onerror=alert(1)&gt;</xmp>",
+		"Raw text outside of style should be escaped")
+}
+
+func TestSanitizedHTMLTracking(t *testing.T) {
+	mime := &MIMEBody{Html: `<img srcset="cid:a 1x, http://tracker.example.com/p.gif 2x">` +
+		`<img srcset="cid:a 1x,cid:b 2x">` +
+		`<span style="background: u\72l(http://tracker.example.com/p.gif)">a</span>` +
+		`<span style="background: \75rl(http://tracker.example.com/p.gif)">b</span>` +
+		`<style>p { background: u\72l(http://tracker.example.com/p.gif) }</style>`}
+	html, err := mime.SanitizedHTML()
+	if !assert.Nil(t, err, "Sanitizing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, html, `<img><img srcset="cid:a 1x,cid:b 2x"><span>a</span><span>b</span>`+
+		`<style></style>`, "Every srcset candidate and escaped CSS should be checked")
+}
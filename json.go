@@ -0,0 +1,31 @@
+package enmime
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JSON unmarshals the decoded content of an application/json part into v, like
+// json.Unmarshal.  Structured types with a +json suffix, such as application/ld+json, are
+// accepted too.  Content declared in a charset other than UTF-8 is converted first.  An error
+// is returned for any other content type, or if the content is not valid JSON.
+func JSON(p MIMEPart, v interface{}) error {
+	ctype := p.ContentType()
+	if ctype != "application/json" && !(strings.HasPrefix(ctype, "application/") &&
+		strings.HasSuffix(ctype, "+json")) {
+		return fmt.Errorf("Not a JSON part: %v", ctype)
+	}
+	content := p.Content()
+	decoder, err := charsetDecoder(contentCharset(p))
+	if err != nil {
+		return err
+	}
+	if decoder != nil {
+		content, err = decoder.Bytes(content)
+		if err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(content, v)
+}
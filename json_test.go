@@ -0,0 +1,35 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"net/textproto"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	var v struct {
+		Name  string
+		Count int
+	}
+	p := &memMIMEPart{contentType: "application/json",
+		content: []byte(`{"name": "widget", "count": 3}`)}
+	assert.Nil(t, JSON(p, &v), "Unmarshaling should not have generated an error")
+	assert.Equal(t, v.Name, "widget", "Expected name to be set")
+	assert.Equal(t, v.Count, 3, "Expected count to be set")
+
+	p = &memMIMEPart{contentType: "application/ld+json",
+		content: []byte("{\"name\": \"caf\xe9\"}"),
+		header: textproto.MIMEHeader{
+			"Content-Type": {"application/ld+json; charset=iso-8859-1"}}}
+	assert.Nil(t, JSON(p, &v), "Unmarshaling should not have generated an error")
+	assert.Equal(t, v.Name, "café", "Content should be converted from its charset")
+
+	p = &memMIMEPart{contentType: "application/json", content: []byte(`{"name": `)}
+	assert.NotNil(t, JSON(p, &v), "Invalid JSON should generate an error")
+
+	p = &memMIMEPart{contentType: "text/plain", content: []byte(`{}`)}
+	err := JSON(p, &v)
+	if assert.NotNil(t, err, "A text part should generate an error") {
+		assert.Contains(t, err.Error(), "text/plain", "Error should name the content type")
+	}
+}
@@ -1,63 +1,124 @@
 package enmime
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
-	"mime"
 	"net/mail"
+	"net/textproto"
 	"strings"
 )
 
 // MIMEBody is the outer wrapper for MIME messages.
 type MIMEBody struct {
-	Text        string     // The plain text portion of the message
-	Html        string     // The HTML portion of the message
-	Root        MIMEPart   // The top-level MIMEPart
-	Attachments []MIMEPart // All parts having a Content-Disposition of attachment
-	Inlines     []MIMEPart // All parts having a Content-Disposition of inline
+	Text        string      // The plain text portion of the message
+	Html        string      // The HTML portion of the message
+	TextPart    MIMEPart    // The part providing Text, nil if none
+	HtmlPart    MIMEPart    // The part providing Html, nil if none
+	Root        MIMEPart    // The top-level MIMEPart
+	Attachments []MIMEPart  // All parts having a Content-Disposition of attachment
+	Inlines     []MIMEPart  // All parts having a Content-Disposition of inline
+	Errors      []*Error    // Problems recovered from and actions taken by the Parser
+	header      mail.Header // Header from the original message
+	rawBody     []byte      // Undecoded body, if kept by the Parser
 }
 
 // IsMultipartMessage returns true if the message has a recognized multipart Content-Type
-// header.  You don't need to check this before calling ParseMIMEBody, it can handle
-// non-multipart messages.
+// header, including nonstandard aliases of multipart/alternative such as
+// application/alternative when a boundary is given.  You don't need to check this before
+// calling ParseMIMEBody, it can handle non-multipart messages.
 func IsMultipartMessage(mailMsg *mail.Message) bool {
 	// Parse top-level multipart
 	ctype := mailMsg.Header.Get("Content-Type")
-	mediatype, _, err := mime.ParseMediaType(ctype)
+	mediatype, params, err := parseMediaType(ctype)
 	if err != nil {
 		return false
 	}
+	if alias := mediaTypeAliases[mediatype]; alias != "" && params["boundary"] != "" {
+		mediatype = alias
+	}
 	switch mediatype {
 	case "multipart/alternative",
+		"multipart/encrypted",
 		"multipart/mixed",
-		"multipart/related":
+		"multipart/related",
+		"multipart/report",
+		"multipart/signed":
 		return true
 	}
 
 	return false
 }
 
+// IsLegacyRFC822 returns true if the message predates MIME: it has no MIME-Version header and
+// no multipart Content-Type.  Such a message is parsed as a single text body, still decoded
+// according to any Content-Transfer-Encoding header.
+func (m *MIMEBody) IsLegacyRFC822() bool {
+	return m.header.Get("MIME-Version") == "" && m.Root == nil
+}
+
+// RawBody returns the body of the message exactly as it was read: everything after the
+// header, without any decoding or splitting into parts.  It is only available when the
+// message was parsed by a Parser with KeepRawBody set, otherwise it returns nil.
+func (m *MIMEBody) RawBody() []byte {
+	return m.rawBody
+}
+
+// RawBodyReader returns a reader of the body returned by RawBody.  The reader implements
+// io.WriterTo, so io.Copy writes the body to its destination straight from the kept copy,
+// without an intermediate buffer.  It returns nil if the body was not kept.
+func (m *MIMEBody) RawBodyReader() *bytes.Reader {
+	if m.rawBody == nil {
+		return nil
+	}
+	return bytes.NewReader(m.rawBody)
+}
+
 // ParseMIMEBody parses the body of the message object into a  tree of MIMEPart objects,
 // each of which is aware of its content type, filename and headers.  If the part was
 // encoded in quoted-printable or base64, it is decoded before being stored in the
 // MIMEPart object.
 func ParseMIMEBody(mailMsg *mail.Message) (*MIMEBody, error) {
-	mimeMsg := new(MIMEBody)
+	return new(Parser).ParseMIMEBody(mailMsg)
+}
+
+// ParseMIMEBody parses the body of the message object like the package level ParseMIMEBody
+// function, using the options set on the Parser.
+func (p *Parser) ParseMIMEBody(mailMsg *mail.Message) (*MIMEBody, error) {
+	body := mailMsg.Body
+	if IsMultipartMessage(mailMsg) {
+		body = p.messageBody(body, mailMsg.Header.Get("Content-Type"))
+	}
+	body = p.reset(body)
+	defer func() { p.bytesRead = p.counter.n }()
+	mimeMsg := &MIMEBody{header: mailMsg.Header}
 
 	if !IsMultipartMessage(mailMsg) {
 		// Parse as text only
-		bodyBytes, err := decodeSection(mailMsg.Header.Get("Content-Transfer-Encoding"),
-			mailMsg.Body)
+		mediatype, params, _ := parseMediaType(mailMsg.Header.Get("Content-Type"))
+		bodyBytes, charset, err := p.decodeContent(mediatype, params,
+			mailMsg.Header.Get("Content-Transfer-Encoding"), body)
 		if err != nil {
 			return nil, err
 		}
 		mimeMsg.Text = string(bodyBytes)
+		if mediatype == "" {
+			mediatype = "text/plain"
+		}
+		// Not part of a tree, but gives access to the header and charset of the body
+		textPart := &memMIMEPart{header: textproto.MIMEHeader(mailMsg.Header),
+			contentType: mediatype, charset: charset, content: bodyBytes}
+		p.recordSize(textPart)
+		mimeMsg.TextPart = textPart
+		mimeMsg.Attachments = p.linkYEnc(textPart)
 	} else {
 		// Parse top-level multipart
 		ctype := mailMsg.Header.Get("Content-Type")
-		mediatype, params, err := mime.ParseMediaType(ctype)
+		mediatype, params, err := parseMediaType(ctype)
 		if err != nil {
 			return nil, err
 		}
+		mediatype = p.aliasMediaType(mediatype, params)
 		if !strings.HasPrefix(mediatype, "multipart/") {
 			return nil, fmt.Errorf("Unknown mediatype: %v", mediatype)
 		}
@@ -68,37 +129,221 @@ func ParseMIMEBody(mailMsg *mail.Message) (*MIMEBody, error) {
 
 		// Root Node of our tree
 		root := NewMIMEPart(nil, mediatype)
-		err = parseParts(root, mailMsg.Body, boundary)
+		root.header = textproto.MIMEHeader(mailMsg.Header)
+		err = p.parseParts(root, body, boundary)
 		if err != nil {
 			return nil, err
 		}
+		mimeMsg.Root = root
 
 		// Locate text body
-		match := BreadthMatchFirst(root, func(p MIMEPart) bool {
-			return p.ContentType() == "text/plain" && p.Disposition() != "attachment"
-		})
-		if match != nil {
+		if match := textBodyPart(root); match != nil {
+			mimeMsg.TextPart = match
 			mimeMsg.Text = string(match.Content())
+			if p.ConcatTextParts {
+				mimeMsg.Text = concatTextParts(match)
+			}
 		}
 
 		// Locate HTML body
-		match = BreadthMatchFirst(root, func(p MIMEPart) bool {
-			return p.ContentType() == "text/html" && p.Disposition() != "attachment"
-		})
-		if match != nil {
+		if match := htmlBodyPart(root); match != nil {
+			mimeMsg.HtmlPart = match
 			mimeMsg.Html = string(match.Content())
 		}
 
 		// Locate attachments
-		mimeMsg.Attachments = BreadthMatchAll(root, func(p MIMEPart) bool {
-			return p.Disposition() == "attachment"
-		})
+		mimeMsg.Attachments = BreadthMatchAll(root, isAttachment)
 
 		// Locate inlines
 		mimeMsg.Inlines = BreadthMatchAll(root, func(p MIMEPart) bool {
-			return p.Disposition() == "inline"
+			return p.Disposition() == "inline" && !isAppleDouble(p) && !isAppleFile(p)
 		})
 	}
+	raw, err := p.rawBody(body)
+	if err != nil {
+		return nil, err
+	}
+	mimeMsg.rawBody = raw
+	mimeMsg.Errors = p.errors
 
 	return mimeMsg, nil
 }
+
+// textBodyPart locates the part providing the plain text body of the message.
+func textBodyPart(root MIMEPart) MIMEPart {
+	return BreadthMatchFirst(root, func(p MIMEPart) bool {
+		return p.ContentType() == "text/plain" && p.Disposition() != "attachment"
+	})
+}
+
+// concatTextParts joins the content of first with that of its following text/plain siblings
+// when they are children of a multipart/mixed, see Parser.ConcatTextParts.
+func concatTextParts(first MIMEPart) string {
+	parent := first.Parent()
+	if parent == nil || parent.ContentType() != "multipart/mixed" {
+		return string(first.Content())
+	}
+	var texts []string
+	for p := first; p != nil; p = p.NextSibling() {
+		if p.ContentType() == "text/plain" && p.Disposition() != "attachment" {
+			texts = append(texts, string(p.Content()))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// htmlBodyPart locates the part providing the HTML body of the message, preferring the HTML
+// alternative of the first multipart/alternative, then the root of a multipart/related with a
+// start parameter.
+func htmlBodyPart(root MIMEPart) MIMEPart {
+	alternative := BreadthMatchFirst(root, func(p MIMEPart) bool {
+		return p.ContentType() == "multipart/alternative"
+	})
+	if alternative != nil {
+		if html := htmlAlternative(alternative); html != nil {
+			return html
+		}
+	}
+	related := BreadthMatchFirst(root, func(p MIMEPart) bool {
+		return p.ContentType() == "multipart/related"
+	})
+	if related != nil && relatedStart(related) != "" {
+		start := RelatedRoot(related)
+		if start != nil && start.ContentType() == "text/html" && start.Disposition() != "attachment" {
+			return start
+		}
+	}
+	return BreadthMatchFirst(root, func(p MIMEPart) bool {
+		return p.ContentType() == "text/html" && p.Disposition() != "attachment"
+	})
+}
+
+// htmlAlternative returns the last HTML alternative of a multipart/alternative: either a
+// text/html child, or the root of a multipart/related child as sent by Outlook for HTML with
+// inline images.  It returns nil if no alternative is HTML.
+func htmlAlternative(alternative MIMEPart) MIMEPart {
+	var html MIMEPart
+	for c := alternative.FirstChild(); c != nil; c = c.NextSibling() {
+		candidate := c
+		if c.ContentType() == "multipart/related" {
+			candidate = RelatedRoot(c)
+		}
+		if candidate != nil && candidate.ContentType() == "text/html" &&
+			candidate.Disposition() != "attachment" {
+			html = candidate
+		}
+	}
+	return html
+}
+
+// isAttachment is the MIMEPartMatcher used to locate attachments.  In addition to parts with
+// an attachment disposition, it matches the data fork of a multipart/appledouble, which is
+// the effective attachment; the container and its resource fork are never matched.
+func isAttachment(p MIMEPart) bool {
+	if isAppleDouble(p) || isAppleFile(p) {
+		return false
+	}
+	if parent := p.Parent(); parent != nil && isAppleDouble(parent) {
+		return p.Disposition() != "inline" && (p.Disposition() == "attachment" ||
+			parent.Disposition() == "attachment" || p.FileName() != "")
+	}
+	return p.Disposition() == "attachment"
+}
+
+// AllAttachments returns the attachments found anywhere in the tree below root, like the
+// Attachments of a MIMEBody, and recurses into forwarded messages: the content of each
+// message/rfc822 part is parsed and searched in turn, at any depth.  A forwarded message sent
+// as an attachment is returned itself, followed by the attachments inside it.  Parts found in
+// forwarded messages belong to a separate tree, rooted at the forwarded message.  Forwarded
+// messages that fail to parse are not searched.  Messages already parsed by the Parser, see
+// ParseAttachedMessages, are searched as part of the tree.
+func AllAttachments(root MIMEPart) []MIMEPart {
+	var attachments []MIMEPart
+	BreadthMatchAll(root, func(p MIMEPart) bool {
+		if isAttachment(p) {
+			attachments = append(attachments, p)
+		}
+		if p.ContentType() == "message/rfc822" && p.FirstChild() == nil {
+			forwarded, err := ParseMIME(bufio.NewReader(bytes.NewReader(p.Content())))
+			if err == nil {
+				attachments = append(attachments, AllAttachments(forwarded)...)
+			}
+		}
+		return false
+	})
+	return attachments
+}
+
+// AttachmentRatio returns the share of the decoded size of the message taken by its
+// Attachments, between 0 and 1, for deciding whether to store attachments apart from the
+// body.  The total counts the decoded content of every part that is not a multipart, so
+// headers and transfer encoding overhead are left out.  Parts linked below such a part, as
+// by ParseAttachedMessages or DecodeYEnc, are derived from its content and not counted again.
+// It returns 0 for a message that is not multipart, has no attachments, or has no content at
+// all.
+func (m *MIMEBody) AttachmentRatio() float64 {
+	if m.Root == nil || len(m.Attachments) == 0 {
+		return 0
+	}
+	sizes := make(map[MIMEPart]int)
+	var walk func(p MIMEPart)
+	walk = func(p MIMEPart) {
+		if !strings.HasPrefix(p.ContentType(), "multipart/") {
+			sizes[p] = len(p.Content())
+			return
+		}
+		for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+			walk(c)
+		}
+	}
+	walk(m.Root)
+	var total, attached int
+	for _, size := range sizes {
+		total += size
+	}
+	for _, p := range m.Attachments {
+		attached += sizes[p]
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(attached) / float64(total)
+}
+
+// isAppleDouble returns true if p is a multipart/appledouble container, used by Mac mail
+// clients to send a file's resource fork alongside its data.
+func isAppleDouble(p MIMEPart) bool {
+	return p.ContentType() == "multipart/appledouble"
+}
+
+// isAppleFile returns true if p is the resource fork of a multipart/appledouble.
+func isAppleFile(p MIMEPart) bool {
+	parent := p.Parent()
+	return p.ContentType() == "application/applefile" && parent != nil && isAppleDouble(parent)
+}
+
+// RelatedRoot returns the root part of a multipart/related part: the child whose Content-ID
+// matches the start parameter of its Content-Type, or the first child if there is no start
+// parameter (RFC 2387).  It returns nil if the start parameter does not match any child.
+func RelatedRoot(related MIMEPart) MIMEPart {
+	start := relatedStart(related)
+	if start == "" {
+		return related.FirstChild()
+	}
+	for c := related.FirstChild(); c != nil; c = c.NextSibling() {
+		if contentID(c) == start {
+			return c
+		}
+	}
+	return nil
+}
+
+// relatedStart returns the start parameter of a multipart/related part without its angle
+// brackets.
+func relatedStart(related MIMEPart) string {
+	_, params, err := parseMediaType(related.Header().Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(params["start"]), "<"), ">")
+}
@@ -5,9 +5,11 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/stretchrcom/testify/assert"
+	"io/ioutil"
 	"net/mail"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -31,6 +33,30 @@ func TestParseNonMime(t *testing.T) {
 	assert.Contains(t, mime.Text, "This is a test mailing")
 }
 
+func TestIsLegacyRFC822(t *testing.T) {
+	msg := readMessage("non-mime.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse non-MIME: %v", err)
+	}
+	assert.True(t, mime.IsLegacyRFC822(), "Message without MIME-Version should be legacy")
+	assert.Equal(t, mime.Text, "This is a test mailing\r\n\r\n", "Body should be read in full")
+
+	msg = readMessage("quoted-printable.raw")
+	mime, err = ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.False(t, mime.IsLegacyRFC822(), "Message with MIME-Version should not be legacy")
+
+	msg = readMessage("attachment.raw")
+	mime, err = ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.False(t, mime.IsLegacyRFC822(), "Multipart message should not be legacy")
+}
+
 func TestParseInlineText(t *testing.T) {
 	msg := readMessage("html-mime-inline.raw")
 	mime, err := ParseMIMEBody(msg)
@@ -72,6 +98,33 @@ func TestParseInlineHtml(t *testing.T) {
 	assert.Contains(t, mime.Html, "Test of HTML section")
 }
 
+func TestBodyParts(t *testing.T) {
+	msg := readMessage("html-mime-inline.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	if assert.NotNil(t, mime.TextPart, "Should have a text part") {
+		assert.Equal(t, string(mime.TextPart.Content()), mime.Text, "TextPart should provide Text")
+	}
+	if assert.NotNil(t, mime.HtmlPart, "Should have an HTML part") {
+		assert.Equal(t, mime.HtmlPart.ContentType(), "text/html", "HtmlPart should be HTML")
+		assert.Equal(t, string(mime.HtmlPart.Content()), mime.Html, "HtmlPart should provide Html")
+	}
+
+	msg = readMessage("quoted-printable.raw")
+	mime, err = ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	if assert.NotNil(t, mime.TextPart, "Non-multipart body should have a text part") {
+		assert.Equal(t, mime.TextPart.Header().Get("Content-Transfer-Encoding"),
+			"quoted-printable", "TextPart should have the message header")
+		assert.Equal(t, string(mime.TextPart.Content()), mime.Text, "TextPart should provide Text")
+	}
+	assert.Nil(t, mime.HtmlPart, "Missing HTML should be nil")
+}
+
 func TestParseAttachment(t *testing.T) {
 	msg := readMessage("attachment.raw")
 	mime, err := ParseMIMEBody(msg)
@@ -92,6 +145,100 @@ func TestParseAttachment(t *testing.T) {
 	//}
 }
 
+func TestParseAppleDouble(t *testing.T) {
+	msg := readMessage("appledouble.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Equal(t, mime.Text, "A text section", "Should have text section")
+	assert.Equal(t, len(mime.Inlines), 0, "Should have no inlines")
+	if !assert.Equal(t, len(mime.Attachments), 1, "Should have a single attachment") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Attachments[0].ContentType(), "text/plain",
+		"Attachment should be the data fork")
+	assert.Equal(t, mime.Attachments[0].FileName(), "report.txt",
+		"Attachment should have correct filename")
+	assert.Equal(t, string(mime.Attachments[0].Content()), "The data fork",
+		"Attachment should have correct content")
+}
+
+func TestParseLFOnly(t *testing.T) {
+	raw := "From: James Hillyerd <james@makita.skynet>\n" +
+		"Subject: LF only\n" +
+		"Content-Type: multipart/alternative;\n" +
+		"\tboundary=\"Enmime-Test-100\"\n" +
+		"\n" +
+		"--Enmime-Test-100\n" +
+		"Content-Type: text/plain\n" +
+		"\n" +
+		"Text body\n" +
+		"--Enmime-Test-100\n" +
+		"Content-Type: text/html\n" +
+		"Content-Transfer-Encoding: base64\n" +
+		"\n" +
+		"PGh0bWw+SFRNTCBib2R5PC9odG1sPg==\n" +
+		"--Enmime-Test-100--\n"
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Equal(t, msg.Header.Get("Subject"), "LF only", "Headers should end at the blank line")
+	assert.Equal(t, mime.Text, "Text body", "Should have text section")
+	assert.Equal(t, mime.Html, "<html>HTML body</html>", "Should have decoded html section")
+}
+
+func TestParseInvalidBoundaryParam(t *testing.T) {
+	msg, err := mail.ReadMessage(strings.NewReader("Content-Type: multipart/mixed; " +
+		"boundary==_Enmime_=_\r\n\r\n" +
+		"--=_Enmime_=_\r\n" +
+		"Content-Type: text/plain\r\n\r\n" +
+		"Text body\r\n" +
+		"--=_Enmime_=_--\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	assert.True(t, IsMultipartMessage(msg), "Failed to identify multipart MIME message")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Equal(t, mime.Text, "Text body", "Should have text section")
+}
+
+func TestParseRelatedStart(t *testing.T) {
+	msg := readMessage("related-start.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Contains(t, mime.Html, "The root HTML", "Should have selected the start part")
+	root := RelatedRoot(mime.Root)
+	if assert.NotNil(t, root, "Should have resolved the related root") {
+		assert.Equal(t, root.Header().Get("Content-Id"), "<root@skynet>",
+			"Related root should match start parameter")
+	}
+
+	// Without a start parameter the first child is the root
+	msg = readMessage("html-mime-inline.raw")
+	mime, err = ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	related := mime.Root.FirstChild().NextSibling()
+	assert.True(t, RelatedRoot(related) == related.FirstChild(),
+		"Related root should default to the first child")
+}
+
 func TestParseInline(t *testing.T) {
 	msg := readMessage("html-mime-inline.raw")
 	mime, err := ParseMIMEBody(msg)
@@ -108,6 +255,78 @@ func TestParseInline(t *testing.T) {
 		"Content should be PNG image")
 }
 
+func TestParseAlternativeRelated(t *testing.T) {
+	msg := readMessage("alternative-related.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Contains(t, mime.Text, "The plain alternative", "Should have text alternative")
+	assert.Contains(t, mime.Html, "The HTML alternative",
+		"Should have found the HTML inside the related alternative")
+	_, html, images := mime.Renderable()
+	if assert.NotNil(t, html, "Should have a renderable HTML part") {
+		assert.Equal(t, html.Parent().ContentType(), "multipart/related",
+			"HTML should come from the related alternative")
+	}
+	if assert.Equal(t, len(images), 1, "Should have one inline image") {
+		assert.Equal(t, images[0].FileName(), "logo.png", "Expected the related image")
+	}
+}
+
+func TestParseAliasedAlternative(t *testing.T) {
+	msg := readMessage("alias-alternative.raw")
+	assert.True(t, IsMultipartMessage(msg), "Aliased type should be multipart")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Equal(t, mime.Root.ContentType(), "multipart/alternative", "Root should be aliased")
+	assert.Equal(t, mime.Text, "The plain alternative", "Should have text alternative")
+	assert.Contains(t, mime.Html, "The HTML alternative", "Should have html alternative")
+	if assert.Equal(t, len(mime.Errors), 2, "Both aliases should be recorded") {
+		assert.Equal(t, mime.Errors[0].Name, "Nonstandard Type", "Error should name the problem")
+		assert.Contains(t, mime.Errors[1].Detail, "multipart/x-alternative",
+			"Detail should name the type")
+	}
+}
+
+func TestAttachmentRatio(t *testing.T) {
+	msg := readMessage("renderable.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	// Leaf parts decode to 53 (html) + 8 (png) + 14 (text) + 6 (jpeg) + 5 (pdf) bytes, and
+	// the png and jpeg are attachments
+	assert.Equal(t, mime.AttachmentRatio(), 14.0/86.0, "Unexpected ratio")
+
+	mime, err = ParseMIMEBody(readMessage("html-mime-inline.raw"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, mime.AttachmentRatio(), 0.0, "Message without attachments should be 0")
+
+	mime, err = ParseMIMEBody(readMessage("non-mime.raw"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, mime.AttachmentRatio(), 0.0, "Non-multipart message should be 0")
+
+	p := &Parser{ParseAttachedMessages: true}
+	mime, err = p.ParseMIMEBody(readMessage("attached-eml.raw"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	// The attached message is counted once, not again as its parsed parts
+	eml := len(mime.Attachments[0].Content())
+	assert.Equal(t, mime.AttachmentRatio(), float64(eml)/float64(eml+len(mime.Text)),
+		"Attached message should be counted once")
+}
+
 // readMessage is a test utility function to fetch a mail.Message object.
 func readMessage(filename string) *mail.Message {
 	// Open test email for parsing
@@ -125,3 +344,68 @@ func readMessage(filename string) *mail.Message {
 
 	return msg
 }
+
+// readRaw is a test utility function to fetch the raw bytes of a test email.
+func readRaw(filename string) []byte {
+	raw, err := ioutil.ReadFile(filepath.Join("test-data", "mail", filename))
+	if err != nil {
+		panic(fmt.Sprintf("Failed to read test data: %v", err))
+	}
+	return raw
+}
+
+func TestParseEmptyMultipart(t *testing.T) {
+	msg := readMessage("empty-multipart.raw")
+	mime, err := ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	if !assert.NotNil(t, mime.Root, "Root should be set") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Root.ContentType(), "multipart/mixed", "Root should be the multipart")
+	assert.Nil(t, mime.Root.FirstChild(), "Root should have no children")
+	assert.Equal(t, mime.Text, "", "Text should be empty")
+	assert.Equal(t, mime.Html, "", "Html should be empty")
+	assert.Equal(t, len(mime.Attachments), 0, "Should have no attachments")
+	if assert.Equal(t, len(mime.Errors), 1, "Empty multipart should be recorded") {
+		assert.Equal(t, mime.Errors[0].Name, "Empty Multipart", "Error should name the problem")
+	}
+}
+
+func TestParseDuplicateFilename(t *testing.T) {
+	msg := readMessage("duplicate-filename.raw")
+	mime, err := ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	if !assert.Equal(t, len(mime.Attachments), 1, "Should have an attachment") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Attachments[0].FileName(), "a;1.txt", "First filename should be used")
+	if assert.Equal(t, len(mime.Errors), 1, "Duplicate should be recorded") {
+		assert.Equal(t, mime.Errors[0].Name, "Duplicate Parameter", "Error should name the problem")
+		assert.Contains(t, mime.Errors[0].Detail, "filename", "Error should name the parameter")
+	}
+}
+
+func TestAllAttachments(t *testing.T) {
+	msg := readMessage("forwarded.raw")
+	mime, err := ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, len(mime.Attachments), 1, "Attachments should only hold the top-level one")
+
+	all := AllAttachments(mime.Root)
+	if !assert.Equal(t, len(all), 2, "Should find the nested attachment too") {
+		t.FailNow()
+	}
+	assert.Equal(t, all[0].FileName(), "outer.txt", "First should be the outer attachment")
+	assert.Equal(t, all[1].FileName(), "inner.bin", "Second should be the forwarded attachment")
+	assert.Equal(t, string(all[1].Content()), "Inner attachment",
+		"Forwarded attachment should be decoded")
+}
@@ -0,0 +1,503 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Parser holds options that control how MIME messages are parsed.  The zero value parses
+// messages exactly like the package level ParseMIMEBody and ParseMIME functions.  A Parser
+// keeps state while parsing, so it must not be used by more than one goroutine at a time.
+type Parser struct {
+	// Lenient makes the parser recover from problems that would otherwise cause the parse to
+	// fail.  Each problem is recorded in the Errors of the resulting MIMEBody.
+	Lenient bool
+
+	// MaxTotalSize limits the number of decoded content bytes across all parts of a message,
+	// zero means no limit.  When exceeded the parse fails with a LimitError, or in lenient
+	// mode the offending content is truncated.
+	MaxTotalSize int64
+
+	// MaxDecompressedSize limits the number of bytes ReadMIMEBodyMaybeGzip and
+	// DecompressedContent will gunzip from a single stream, to guard against decompression
+	// bombs.  Exceeding it results in a LimitError.  DefaultMaxDecompressedSize is used if zero.
+	MaxDecompressedSize int64
+
+	// PreambleAsText exposes text found before the first boundary of a multipart as a
+	// synthetic text/plain part, for malformed messages that put their body there.  It has no
+	// effect unless Lenient is also set.
+	PreambleAsText bool
+
+	// DisallowedTypes lists content types, such as "application/x-msdownload" or
+	// "application/*", of attachments to be dropped while parsing.  A dropped part remains in
+	// the tree without content, and is recorded in the Errors of the MIMEBody.
+	DisallowedTypes []string
+
+	// DisallowedExtensions lists file name extensions, such as ".exe", of attachments to be
+	// dropped while parsing, in the same way as DisallowedTypes.  Matching ignores case.
+	DisallowedExtensions []string
+
+	// QPDecoder decodes quoted-printable content, StdQPDecoder is used if nil.  Set it to
+	// QPrintableDecoder for the CRLF line break translation of earlier releases.
+	QPDecoder QPDecoder
+
+	// KeepInvalidUTF8 stops UTF8Content and UTF8Reader from replacing invalid UTF-8 sequences
+	// with U+FFFD, for strict callers that need the converted bytes unaltered.
+	KeepInvalidUTF8 bool
+
+	// KeepRawBody keeps a copy of the message body exactly as read, before any decoding or
+	// splitting into parts, available from MIMEBody.RawBody.  This is needed for DKIM body
+	// hashing or re-signing, at the cost of holding the body in memory twice.
+	KeepRawBody bool
+
+	// KeepRawContent keeps the content of each leaf part exactly as read, before transfer and
+	// charset decoding, available from RawContent along with the decoded Content.  The raw
+	// bytes are captured while decoding, so the message is still read only once, at the cost
+	// of holding each part's content in memory twice.
+	KeepRawContent bool
+
+	// TrimTextParts removes leading blank lines and trailing whitespace from the decoded
+	// content of text parts, for display focused callers.  It is lossy, so it is off by
+	// default; the content of non-text parts is never trimmed.
+	TrimTextParts bool
+
+	// KeepBOM keeps a byte order mark found at the start of UTF-8 text parts.  By default it is
+	// removed from the decoded content, as it confuses software displaying or indexing the text.
+	KeepBOM bool
+
+	// ConcatTextParts makes the Text of a MIMEBody the concatenation of all the sibling
+	// text/plain parts of a multipart/mixed, in order and separated by a line break, for
+	// messages such as those from ticketing systems that send a body and a footer as separate
+	// parts.  Parts with an attachment disposition are skipped.  By default only the first
+	// text part is used.
+	ConcatTextParts bool
+
+	// DecodeBodyOnly speeds up parsing attachment heavy messages for display: only text parts
+	// that are not attachments are decoded into memory while parsing.  The content of all
+	// other parts is streamed through its decoder to check it, but kept encoded and decoded
+	// the first time its Content method is called.  Content that fails the check fails the
+	// parse, or in lenient mode is decoded while parsing like that of any other part; a later
+	// failure is reported by DecodeError.  MaxTotalSize applies to the encoded size of
+	// deferred parts.
+	DecodeBodyOnly bool
+
+	// DecodeInlineImages also decodes inline images while parsing when DecodeBodyOnly is set,
+	// for clients that display them along with the body.
+	DecodeInlineImages bool
+
+	// PartHandler, if set, is called with each part below the root as soon as it has been
+	// parsed, for processing huge multipart messages in bounded memory.  Completed parts are
+	// not kept: they are passed to the handler instead of being linked into the tree, so only
+	// the root and the ancestors of the current part are held in memory.  Parts are passed in
+	// document order, a multipart before its children.  Their Parent is set, but FirstChild
+	// and NextSibling are always nil, and the Text, Html, Attachments and Inlines of a MIMEBody
+	// remain empty.  A non-nil error returned by the handler aborts the parse and is returned.
+	PartHandler func(part MIMEPart) error
+
+	// NoDecode keeps the content of every part exactly as it appears in the message, still
+	// transfer encoded and in its original charset, for archival tools that must store the
+	// original faithfully while using the structure of the tree.  TransferEncoding reports the
+	// encoding that was not applied.  TrimTextParts and DecodeBodyOnly have no effect.
+	NoDecode bool
+
+	// ASCIIFallbackCharset decodes text parts labeled us-ascii that nevertheless contain 8-bit
+	// bytes, and are not valid UTF-8 either, as many mailers send Latin text this way.  It
+	// defaults to windows-1252 when empty; set it to "us-ascii" to leave such content as is.
+	ASCIIFallbackCharset string
+
+	// ParseAttachedMessages parses the content of attached messages, message/rfc822 parts and
+	// application/octet-stream parts with a .eml file name, and links the root of the attached
+	// message below the part as its only child, for tools that drill into messages forwarded
+	// as attachments.  The Text, Html, Attachments and Inlines of a MIMEBody are then also
+	// looked for in attached messages, after the parts of the message itself.  An attached
+	// message without a Content-Type is parsed as text/plain, and its decoded content counts
+	// against MaxTotalSize along with that of the attachment.  An attached message that fails
+	// to parse is left as a leaf and recorded in the Errors.  It has no effect on parts
+	// deferred by DecodeBodyOnly, nor with NoDecode.
+	ParseAttachedMessages bool
+
+	// TextTypes lists the content types besides text/* that the IsText method treats as text,
+	// which may contain wildcards like DisallowedTypes.  DefaultTextTypes is used if nil.
+	TextTypes []string
+
+	// DecodeYEnc looks for yEnc encoded files in text/plain parts, as sent by Usenet gateways,
+	// and links each file decoded below the part as an application/octet-stream attachment
+	// named after the file, see DecodeYEnc.  The text of the part is kept as is.  For a message
+	// that is not multipart, the files are linked below the TextPart of the MIMEBody and
+	// listed in its Attachments.  Blocks that cannot be decoded or fail their CRC-32 check are
+	// recorded in the Errors and skipped.
+	DecodeYEnc bool
+
+	total     int64           // Decoded bytes so far
+	errors    []*Error        // Problems recovered from so far
+	counter   *countingReader // Tracks position in the message body
+	raw       *bytes.Buffer   // Copy of the message body when KeepRawBody is set
+	ctx       context.Context // Context of the parse in progress, see ParseWithContext
+	charsets  map[string]bool // Unknown charsets seen across all parses
+	bytesRead int64           // Bytes read from the source by the last parse, see BytesRead
+	yenc      []*YEncFile     // Files found by the last decodeContent, see DecodeYEnc
+	size      int64           // Transfer decoded size found by the last decodeContent
+	sizeErr   error           // Why the last decodeContent could not find the size
+}
+
+// reset prepares the parser to parse a new message body read from r, returning the reader
+// the parser should consume the body through.
+func (p *Parser) reset(r io.Reader) io.Reader {
+	p.total = 0
+	p.errors = nil
+	p.raw = nil
+	if p.KeepRawBody {
+		p.raw = new(bytes.Buffer)
+		r = io.TeeReader(r, p.raw)
+	}
+	p.counter = &countingReader{in: r}
+	return p.counter
+}
+
+// rawBody returns the copy of the message body kept by KeepRawBody, or nil.  body must be the
+// reader returned by reset; anything left unread, such as a multipart epilogue, is read first
+// so that the copy is complete.
+func (p *Parser) rawBody(body io.Reader) ([]byte, error) {
+	if p.raw == nil {
+		return nil, nil
+	}
+	if _, err := io.Copy(ioutil.Discard, body); err != nil {
+		return nil, err
+	}
+	return p.raw.Bytes(), nil
+}
+
+// BytesRead returns the number of bytes the last parse consumed from its source, for metering
+// or to locate the end of a message in a stream of concatenated messages.  ParseMIME and
+// ParseWithContext count the whole message read from the reader they were given, while
+// ParseMIMEBody counts the body only, as the header was already read by the caller.  Reading a
+// multipart message from a *bufio.Reader stops at the line holding its closing delimiter, so
+// the count ends there and the reader is left at the start of what follows; without
+// KeepRawBody the epilogue is not read.  Any other body is read to the end of the source.
+func (p *Parser) BytesRead() int64 {
+	return p.bytesRead
+}
+
+// Errors returns the problems recovered from in lenient mode by the last parse or DecodeAll,
+// along with actions taken such as dropping a disallowed attachment.  Each parse or DecodeAll
+// starts a new list, so the errors of a parse must be read before calling DecodeAll; those of
+// a MIMEBody remain available from its Errors field.
+func (p *Parser) Errors() []*Error {
+	return p.errors
+}
+
+// addError records a problem the parser recovered from.  Since input is buffered, the
+// recorded offset may be somewhat past the actual location of the problem.
+func (p *Parser) addError(name string, format string, args ...interface{}) {
+	p.errors = append(p.errors, &Error{Name: name, Detail: fmt.Sprintf(format, args...),
+		Offset: p.counter.n})
+}
+
+// handlePart passes a parsed part to the PartHandler, if one is set.
+func (p *Parser) handlePart(part MIMEPart) error {
+	if p.PartHandler == nil {
+		return nil
+	}
+	return p.PartHandler(part)
+}
+
+// qpDecoder returns the QPDecoder to use for quoted-printable content.
+func (p *Parser) qpDecoder() QPDecoder {
+	if p.QPDecoder == nil {
+		return StdQPDecoder
+	}
+	return p.QPDecoder
+}
+
+// UnknownCharsets returns the distinct charset names, in lower case and sorted, that were
+// declared by text parts in any of the messages parsed so far but are not supported by
+// enmime.  It is intended for auditing a corpus of messages with a single Parser.
+func (p *Parser) UnknownCharsets() []string {
+	names := make([]string, 0, len(p.charsets))
+	for name := range p.charsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkCharset notes the charset of a text part if it is not supported.  An empty mediatype
+// is treated as text, as for a message without a Content-Type header.
+func (p *Parser) checkCharset(mediatype, charset string) {
+	if charset == "" || mediatype != "" && !strings.HasPrefix(mediatype, "text/") {
+		return
+	}
+	if _, err := charsetDecoder(charset); err != nil {
+		if p.charsets == nil {
+			p.charsets = make(map[string]bool)
+		}
+		p.charsets[cleanCharset(charset)] = true
+	}
+}
+
+// convertCharset converts the decoded content of a text part from charset to UTF-8, returning
+// the content along with the charset it is now in.  Content in a charset that is unsupported,
+// or fails to convert, is left unchanged and recorded in the Errors.  Content mislabeled
+// us-ascii is decoded with the ASCIIFallbackCharset.  An empty mediatype is treated as text,
+// as for a message without a Content-Type header.
+func (p *Parser) convertCharset(mediatype, charset string, content []byte) ([]byte, string) {
+	charset = cleanCharset(charset)
+	if charset == "" || mediatype != "" && !strings.HasPrefix(mediatype, "text/") {
+		return content, charset
+	}
+	if (charset == "us-ascii" || charset == "ascii") && !utf8.Valid(content) {
+		fallback := p.ASCIIFallbackCharset
+		if fallback == "" {
+			fallback = "windows-1252"
+		}
+		p.addError("8-bit ASCII", "Content labeled %v has 8-bit bytes, decoded as %v", charset,
+			fallback)
+		charset = cleanCharset(fallback)
+	}
+	decoder, err := charsetDecoder(charset)
+	if err != nil {
+		p.addError("Unsupported Charset", "Content left in unsupported charset %v", charset)
+		return content, charset
+	}
+	if decoder == nil {
+		return content, charset
+	}
+	converted, err := decoder.Bytes(content)
+	if err != nil {
+		p.addError("Charset Conversion", "Content left in charset %v: %v", charset, err)
+		return content, charset
+	}
+	return converted, "utf-8"
+}
+
+// utf8BOM is the byte order mark some Windows software puts at the start of UTF-8 text.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// stripBOM removes a leading byte order mark from the decoded content of a UTF-8 text part,
+// unless KeepBOM is set.  An empty mediatype is treated as text, as for a message without a
+// Content-Type header.
+func (p *Parser) stripBOM(mediatype, charset string, content []byte) []byte {
+	if p.KeepBOM || mediatype != "" && !strings.HasPrefix(mediatype, "text/") {
+		return content
+	}
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return bytes.TrimPrefix(content, utf8BOM)
+	}
+	return content
+}
+
+// trimText applies TrimTextParts to the decoded content of a part.  An empty mediatype is
+// treated as text, as for a message without a Content-Type header.
+func (p *Parser) trimText(mediatype string, content []byte) []byte {
+	if !p.TrimTextParts || mediatype != "" && !strings.HasPrefix(mediatype, "text/") {
+		return content
+	}
+	content = bytes.TrimRightFunc(content, unicode.IsSpace)
+	// Only drop whole lines at the start, preserving indentation of the first text line
+	for {
+		i := bytes.IndexByte(content, '\n')
+		if i < 0 || len(bytes.TrimSpace(content[:i])) > 0 {
+			return content
+		}
+		content = content[i+1:]
+	}
+}
+
+// isDeferred returns true if the content of part should be decoded lazily, see
+// DecodeBodyOnly.
+func (p *Parser) isDeferred(part *memMIMEPart) bool {
+	switch {
+	case !p.DecodeBodyOnly:
+		return false
+	case part.disposition == "attachment":
+		return true
+	case strings.HasPrefix(part.contentType, "text/"):
+		return false
+	case strings.HasPrefix(part.contentType, "image/"):
+		return !p.DecodeInlineImages
+	}
+	return true
+}
+
+// matchesType returns true if ctype, in lower case, matches one of types, which may contain
+// wildcards such as "application/*".
+func matchesType(ctype string, types []string) bool {
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if t == ctype || strings.HasSuffix(t, "/*") && strings.HasPrefix(ctype, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAttachedMessage returns true if part holds a complete message to be parsed when
+// ParseAttachedMessages is set.
+func isAttachedMessage(part *memMIMEPart) bool {
+	switch part.contentType {
+	case "message/rfc822":
+		return true
+	case "application/octet-stream":
+		return strings.HasSuffix(strings.ToLower(part.fileName), ".eml")
+	}
+	return false
+}
+
+// parseAttachedMessage parses the content of part as a message, using the options of p, and
+// links the root of the result below part.  A message without a Content-Type header is parsed
+// as text/plain, as RFC 822 specifies.  The attached message counts against the MaxTotalSize
+// of the enclosing message; only exceeding it is returned as an error, and only when not
+// Lenient.
+func (p *Parser) parseAttachedMessage(part *memMIMEPart) error {
+	if p.charsets == nil {
+		// Shared with the copy below, so unknown charsets of the attached message are kept
+		p.charsets = make(map[string]bool)
+	}
+	sub := *p
+	sub.PartHandler = nil
+	sub.total, sub.errors = 0, nil
+	var root MIMEPart
+	var err error
+	if p.MaxTotalSize > 0 && p.total >= p.MaxTotalSize {
+		err = &LimitError{Kind: LimitTotalSize, Limit: p.MaxTotalSize}
+	} else {
+		if p.MaxTotalSize > 0 {
+			sub.MaxTotalSize = p.MaxTotalSize - p.total
+		}
+		root, err = sub.parseMessage(part.content)
+		p.errors = append(p.errors, sub.errors...)
+		p.total += sub.total
+	}
+	if err != nil {
+		if _, ok := err.(*LimitError); ok && !p.Lenient {
+			return &LimitError{Kind: LimitTotalSize, Limit: p.MaxTotalSize}
+		}
+		p.addError("Attached Message", "Could not parse attached message %q: %v",
+			part.fileName, err)
+		return nil
+	}
+	embedded := root.(*memMIMEPart)
+	embedded.parent = part
+	part.firstChild = embedded
+	return nil
+}
+
+// isDisallowed returns true if part is an attachment matching DisallowedTypes or
+// DisallowedExtensions.  Parts with an attachment disposition or a file name are considered
+// attachments.
+func (p *Parser) isDisallowed(part *memMIMEPart) bool {
+	if part.disposition != "attachment" && part.fileName == "" {
+		return false
+	}
+	if matchesType(part.contentType, p.DisallowedTypes) {
+		return true
+	}
+	ext := strings.ToLower(path.Ext(part.fileName))
+	for _, e := range p.DisallowedExtensions {
+		e = strings.ToLower(e)
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// messageBody returns the reader to consume a message body from, given its Content-Type.  When
+// body is a *bufio.Reader holding a multipart, reading ends at the closing delimiter rather
+// than at the end of body, see BytesRead.  The whole body is read when KeepRawBody is set, as
+// the copy must then include the epilogue.
+func (p *Parser) messageBody(body io.Reader, ctype string) io.Reader {
+	br, ok := body.(*bufio.Reader)
+	if !ok || p.KeepRawBody {
+		return body
+	}
+	mediatype, params, err := parseMediaType(ctype)
+	if err != nil || params["boundary"] == "" {
+		return body
+	}
+	if alias := mediaTypeAliases[mediatype]; alias != "" {
+		mediatype = alias
+	}
+	if !strings.HasPrefix(mediatype, "multipart/") {
+		return body
+	}
+	return &closingReader{in: br, closing: []byte("--" + params["boundary"] + "--"),
+		start: true}
+}
+
+// readHeaderLines reads the lines of a message header from br up to and including the blank
+// line that ends it, or up to the end of br, without reading any further.
+func readHeaderLines(br *bufio.Reader) ([]byte, error) {
+	var head []byte
+	for {
+		line, err := br.ReadBytes('\n')
+		head = append(head, line...)
+		if err != nil {
+			return head, err
+		}
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			return head, nil
+		}
+	}
+}
+
+// closingReader reads the body of a multipart from a bufio.Reader a line at a time, ending
+// after the line holding its closing delimiter, so that nothing past it is taken from in.
+type closingReader struct {
+	in      *bufio.Reader
+	closing []byte // Closing delimiter of the multipart
+	line    []byte // Part of the current line not yet returned
+	start   bool   // Next read from in starts a line
+	done    bool   // Closing delimiter line has been read
+}
+
+// Read method for io.Reader interface.
+func (c *closingReader) Read(b []byte) (int, error) {
+	if len(c.line) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		line, err := c.in.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull {
+			if len(line) == 0 {
+				return 0, err
+			}
+			c.done = true
+		}
+		if c.start && bytes.HasPrefix(line, c.closing) &&
+			len(bytes.TrimRight(line[len(c.closing):], " \t\r\n")) == 0 {
+			c.done = true
+		}
+		c.start = err != bufio.ErrBufferFull
+		c.line = line
+	}
+	n := copy(b, c.line)
+	c.line = c.line[n:]
+	return n, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	in io.Reader
+	n  int64
+}
+
+// Read method for io.Reader interface.
+func (c *countingReader) Read(b []byte) (n int, err error) {
+	n, err = c.in.Read(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,745 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/stretchrcom/testify/assert"
+	"io"
+	"net/mail"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMaxTotalSize(t *testing.T) {
+	msg := readMessage("attachment.raw")
+	p := &Parser{MaxTotalSize: 10}
+	_, err := p.ParseMIMEBody(msg)
+
+	if !assert.NotNil(t, err, "Parsing should have exceeded the size limit") {
+		t.FailNow()
+	}
+	lerr, ok := err.(*LimitError)
+	assert.True(t, ok, "Error should be a LimitError")
+	assert.Equal(t, lerr.Kind, LimitTotalSize, "Limit kind should be total size")
+	assert.Equal(t, lerr.Limit, int64(10), "Limit should be reported")
+}
+
+func TestMaxTotalSizeLenient(t *testing.T) {
+	msg := readMessage("attachment.raw")
+	p := &Parser{MaxTotalSize: 10, Lenient: true}
+	mime, err := p.ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Lenient parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Text, "A text sec", "Text should be truncated to the limit")
+	assert.Equal(t, len(mime.Attachments), 1, "Should have a single attachment")
+	assert.Equal(t, len(mime.Attachments[0].Content()), 0, "Attachment should be truncated")
+	assert.Equal(t, len(mime.Errors), 2, "Both truncations should be recorded")
+}
+
+func TestMaxTotalSizeLenientBuffering(t *testing.T) {
+	encoded := bytes.Repeat([]byte("QUJD\r\n"), 1<<20)
+	source := &countingReader{in: bytes.NewReader(encoded)}
+	p := &Parser{MaxTotalSize: 10, Lenient: true}
+	p.reset(nil)
+	content, err := p.decodeSection("base64", source)
+	if !assert.Nil(t, err, "Lenient decoding should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(content), "ABCABCABCA", "Content should be truncated to the limit")
+	assert.True(t, source.n < int64(len(encoded)/100),
+		"Base64 should not be read far past the limit before decoding")
+}
+
+func TestMaxTotalSizeLenientQPBuffering(t *testing.T) {
+	encoded := bytes.Repeat([]byte("A=3D1 =\r\n"), 1<<20)
+	source := &countingReader{in: bytes.NewReader(encoded)}
+	p := &Parser{MaxTotalSize: 10, Lenient: true}
+	p.reset(nil)
+	content, err := p.decodeSection("quoted-printable", source)
+	if !assert.Nil(t, err, "Lenient decoding should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(content), "A=1 A=1 A=", "Content should be truncated to the limit")
+	assert.True(t, source.n < int64(len(encoded)/100),
+		"Quoted-printable should not be read far past the limit before decoding")
+}
+
+func TestMaxTotalSizeKeepRawContent(t *testing.T) {
+	encoded := strings.Repeat("QUJDREVGR0hJSktMTU5PUFFSU1RVVldYWVo=\r\n", 1<<15)
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" + encoded + "--b--\r\n"
+	p := &Parser{MaxTotalSize: 10, Lenient: true, KeepRawContent: true}
+	root, err := p.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Lenient parsing should not have generated an error") {
+		t.FailNow()
+	}
+	kept := RawContent(root.FirstChild())
+	assert.True(t, len(kept) < len(encoded)/100,
+		"Raw content should not be captured far past the limit")
+	assert.True(t, len(kept) > 0, "Raw content should be captured up to the limit")
+}
+
+func TestMaxTotalSizePreamble(t *testing.T) {
+	body := strings.Repeat("A line that never reaches the boundary\r\n", 1<<15)
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" + body
+	p := &Parser{MaxTotalSize: 100, Lenient: true}
+	root, err := p.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Lenient parsing should not have generated an error") {
+		t.FailNow()
+	}
+	if assert.NotNil(t, root.FirstChild(), "Body should be kept as text") {
+		assert.Equal(t, string(root.FirstChild().Content()), body[:100],
+			"Preamble should be truncated to the limit")
+	}
+	names := make([]string, len(p.Errors()))
+	for i, e := range p.Errors() {
+		names[i] = e.Name
+	}
+	assert.Contains(t, names, "Size Limit Exceeded", "Truncation should be recorded")
+}
+
+func TestMaxTotalSizeNotExceeded(t *testing.T) {
+	msg := readMessage("attachment.raw")
+	p := &Parser{MaxTotalSize: 1024}
+	mime, err := p.ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Text, "A text section", "Text should be complete")
+	assert.Equal(t, len(mime.Errors), 0, "No errors should be recorded")
+}
+
+func TestPreambleAsText(t *testing.T) {
+	msg := readMessage("preamble-body.raw")
+	p := &Parser{Lenient: true, PreambleAsText: true}
+	mime, err := p.ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Text, "The real body text\nis up here.", "Preamble should be the text body")
+	first := mime.Root.FirstChild()
+	assert.Equal(t, first.ContentType(), "text/plain", "Preamble should be a text/plain part")
+	assert.NotNil(t, first.NextSibling(), "Regular part should follow the preamble")
+}
+
+func TestPreambleIgnored(t *testing.T) {
+	msg := readMessage("preamble-body.raw")
+	mime, err := ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Text, "", "Preamble should be ignored by default")
+}
+
+func TestErrorOffset(t *testing.T) {
+	msg := readMessage("attachment.raw")
+	p := &Parser{MaxTotalSize: 10, Lenient: true}
+	mime, err := p.ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Lenient parsing should not have generated an error") {
+		t.FailNow()
+	}
+	if !assert.Equal(t, len(mime.Errors), 2, "Both truncations should be recorded") {
+		t.FailNow()
+	}
+	assert.True(t, mime.Errors[0].Offset > 0, "Offset should be recorded")
+	assert.True(t, mime.Errors[1].Offset >= mime.Errors[0].Offset,
+		"Later errors should not have an earlier offset")
+}
+
+func TestDisallowedTypes(t *testing.T) {
+	msg := readMessage("attachment.raw")
+	p := &Parser{DisallowedTypes: []string{"text/HTML"}}
+	mime, err := p.ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Text, "A text section", "Text should not be dropped")
+	if !assert.Equal(t, len(mime.Attachments), 1, "Dropped attachment should remain in tree") {
+		t.FailNow()
+	}
+	assert.Equal(t, len(mime.Attachments[0].Content()), 0, "Attachment content should be dropped")
+	if assert.Equal(t, len(mime.Errors), 1, "Dropped attachment should be recorded") {
+		assert.Contains(t, mime.Errors[0].Detail, "test.html", "Error should name the file")
+	}
+}
+
+func TestDisallowedExtensions(t *testing.T) {
+	msg := readMessage("attachment.raw")
+	p := &Parser{DisallowedExtensions: []string{"exe", ".HTML"}}
+	mime, err := p.ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, len(mime.Attachments[0].Content()), 0, "Attachment content should be dropped")
+	assert.Equal(t, len(mime.Errors), 1, "Dropped attachment should be recorded")
+
+	msg = readMessage("attachment.raw")
+	p = &Parser{DisallowedTypes: []string{"image/*"}, DisallowedExtensions: []string{"exe"}}
+	mime, err = p.ParseMIMEBody(msg)
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Contains(t, string(mime.Attachments[0].Content()), "<html>",
+		"Allowed attachment should keep its content")
+	assert.Equal(t, len(mime.Errors), 0, "Nothing should be recorded")
+}
+
+func TestUnknownCharsets(t *testing.T) {
+	p := new(Parser)
+	raws := []string{
+		"Content-Type: text/plain; charset=X-Bogus\r\n\r\nOne\r\n",
+		"Content-Type: multipart/mixed; boundary=\"Enmime-Test-100\"\r\n\r\n" +
+			"--Enmime-Test-100\r\n" +
+			"Content-Type: text/plain; charset=x-bogus\r\n\r\nTwo\r\n" +
+			"--Enmime-Test-100\r\n" +
+			"Content-Type: text/html; charset=x-other\r\n\r\nThree\r\n" +
+			"--Enmime-Test-100\r\n" +
+			"Content-Type: text/plain; charset=iso-8859-2\r\n\r\nFour\r\n" +
+			"--Enmime-Test-100\r\n" +
+			"Content-Type: application/octet-stream; charset=x-binary\r\n\r\nFive\r\n" +
+			"--Enmime-Test-100--\r\n",
+	}
+	for _, raw := range raws {
+		msg, err := mail.ReadMessage(strings.NewReader(raw))
+		if err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		if _, err := p.ParseMIMEBody(msg); err != nil {
+			t.Fatalf("Failed to parse MIME: %v", err)
+		}
+	}
+
+	assert.Equal(t, p.UnknownCharsets(), []string{"x-bogus", "x-other"},
+		"Should collect distinct unknown charsets of text parts")
+}
+
+func TestLenientBase64NotEncoded(t *testing.T) {
+	msg := readMessage("base64-not-encoded.raw")
+	p := &Parser{Lenient: true}
+	mime, err := p.ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Lenient parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Text, "Hello, world! This text was decoded already; the label is wrong.",
+		"Raw content should be used")
+	if assert.Equal(t, len(mime.Errors), 1, "Bad encoding should be recorded") {
+		assert.Equal(t, mime.Errors[0].Name, "Malformed Base64", "Error should name the problem")
+	}
+
+	msg = readMessage("base64-not-encoded.raw")
+	_, err = ParseMIMEBody(msg)
+	assert.NotNil(t, err, "Strict parsing should fail")
+}
+
+func TestLenientBase64MislabeledQP(t *testing.T) {
+	raw := "Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"Caf=C3=A9 au lait, a long line that the sender folded with a soft line =\r\n" +
+		"break.\r\n"
+	p := &Parser{Lenient: true}
+	root, err := p.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Lenient parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(root.Content()),
+		"Café au lait, a long line that the sender folded with a soft line break.\r\n",
+		"Content should be decoded as quoted-printable")
+	if assert.Equal(t, len(p.errors), 1, "Mislabeled encoding should be recorded") {
+		assert.Equal(t, p.errors[0].Name, "Mislabeled Encoding", "Error should name the problem")
+	}
+
+	_, err = ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	assert.NotNil(t, err, "Strict parsing should fail")
+}
+
+func TestKeepRawBody(t *testing.T) {
+	raw := string(readRaw("html-mime-inline.raw")) + "Epilogue after the closing boundary\n"
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	p := &Parser{KeepRawBody: true}
+	mime, err := p.ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	body := raw[strings.Index(raw, "\r\n\r\n")+4:]
+	assert.Equal(t, string(mime.RawBody()), body, "Raw body should be everything after the header")
+	assert.Contains(t, mime.Html, "Test of HTML section", "Body should still be parsed")
+
+	var r io.Reader = mime.RawBodyReader()
+	_, ok := r.(io.WriterTo)
+	assert.True(t, ok, "Raw body reader should implement io.WriterTo")
+	out := new(bytes.Buffer)
+	n, err := io.Copy(out, r)
+	assert.Nil(t, err, "Copying should not have generated an error")
+	assert.Equal(t, n, int64(len(body)), "Whole body should be copied")
+	assert.Equal(t, out.String(), body, "Copy should be the raw body")
+
+	mime, err = ParseMIMEBody(readMessage("html-mime-inline.raw"))
+	assert.Nil(t, err, "Parsing should not have generated an error")
+	assert.Nil(t, mime.RawBody(), "Raw body should not be kept by default")
+	assert.Nil(t, mime.RawBodyReader(), "Raw body reader should be nil by default")
+}
+
+func TestStripBOM(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=\"Enmime-BOM\"\r\n" +
+		"\r\n" +
+		"--Enmime-BOM\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"77u/SGVsbG8=\r\n" +
+		"--Enmime-BOM\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"\r\n" +
+		"\xef\xbb\xbfdata\r\n" +
+		"--Enmime-BOM--\r\n"
+	root, err := ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(root.FirstChild().Content()), "Hello", "BOM should be stripped")
+	assert.Equal(t, string(root.FirstChild().NextSibling().Content()), "\xef\xbb\xbfdata",
+		"Binary content should be untouched")
+
+	p := &Parser{KeepBOM: true}
+	root, err = p.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(root.FirstChild().Content()), "\xef\xbb\xbfHello",
+		"BOM should be kept")
+}
+
+func TestTrimTextParts(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=\"Enmime-Trim\"\r\n" +
+		"\r\n" +
+		"--Enmime-Trim\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"\r\n" +
+		"  \r\n" +
+		"  Indented body\r\n" +
+		"\r\n" +
+		"\r\n" +
+		"--Enmime-Trim\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=data.bin\r\n" +
+		"\r\n" +
+		"\r\n" +
+		"data\r\n" +
+		"\r\n" +
+		"--Enmime-Trim--\r\n"
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	p := &Parser{TrimTextParts: true}
+	mime, err := p.ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Text, "  Indented body", "Text should be trimmed keeping indentation")
+	if assert.Equal(t, len(mime.Attachments), 1, "Should have an attachment") {
+		assert.Equal(t, string(mime.Attachments[0].Content()), "\r\ndata\r\n",
+			"Binary content should not be trimmed")
+	}
+
+	msg, err = mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	mime, err = ParseMIMEBody(msg)
+	assert.Nil(t, err, "Parsing should not have generated an error")
+	assert.Equal(t, mime.Text, "\r\n  \r\n  Indented body\r\n\r\n",
+		"Text should not be trimmed by default")
+}
+
+func TestConcatTextParts(t *testing.T) {
+	p := &Parser{ConcatTextParts: true}
+	mime, err := p.ParseMIMEBody(readMessage("multi-text.raw"))
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Text, "Your ticket has been updated.\n--\nHelpdesk footer",
+		"Text parts should be concatenated, skipping the attachment")
+	assert.Equal(t, len(mime.Attachments), 1, "Attachment should still be found")
+
+	mime, err = ParseMIMEBody(readMessage("multi-text.raw"))
+	assert.Nil(t, err, "Parsing should not have generated an error")
+	assert.Equal(t, mime.Text, "Your ticket has been updated.",
+		"Only the first text part should be used by default")
+}
+
+func TestDecodeBodyOnly(t *testing.T) {
+	p := &Parser{DecodeBodyOnly: true}
+	mime, err := p.ParseMIMEBody(readMessage("attachment.raw"))
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Contains(t, mime.Text, "A text section", "Body should be decoded")
+	if !assert.Equal(t, len(mime.Attachments), 1, "Should have an attachment") {
+		t.FailNow()
+	}
+	att := mime.Attachments[0].(*memMIMEPart)
+	assert.NotNil(t, att.decode, "Attachment decoding should be deferred")
+	assert.Contains(t, string(att.Content()), "<html>", "Attachment should decode on demand")
+	assert.Nil(t, att.decode, "Attachment should only be decoded once")
+
+	mime, err = p.ParseMIMEBody(readMessage("html-mime-inline.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Contains(t, mime.Html, "Test of HTML section", "HTML body should be decoded")
+	if !assert.Equal(t, len(mime.Inlines), 1, "Should have an inline image") {
+		t.FailNow()
+	}
+	assert.NotNil(t, mime.Inlines[0].(*memMIMEPart).decode, "Inline image should be deferred")
+
+	p = &Parser{DecodeBodyOnly: true, DecodeInlineImages: true}
+	mime, err = p.ParseMIMEBody(readMessage("html-mime-inline.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	if assert.Equal(t, len(mime.Inlines), 1, "Should have an inline image") {
+		img := mime.Inlines[0].(*memMIMEPart)
+		assert.Nil(t, img.decode, "Inline image should be decoded while parsing")
+		assert.Equal(t, string(img.Content()[1:4]), "PNG", "Inline image should be decoded")
+	}
+}
+
+func TestDecodeBodyOnlyMalformed(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nBody\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=note.txt\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		"Caf=C3=A9 au lait, a long line that the sender folded with a soft line =\r\n" +
+		"break.\r\n--b--\r\n"
+	p := &Parser{DecodeBodyOnly: true}
+	_, err := p.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	assert.NotNil(t, err, "Strict parsing should fail on a deferred part")
+
+	p = &Parser{DecodeBodyOnly: true, Lenient: true}
+	root, err := p.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Lenient parsing should not have generated an error") {
+		t.FailNow()
+	}
+	att := root.FirstChild().NextSibling()
+	assert.Equal(t, string(att.Content()),
+		"Café au lait, a long line that the sender folded with a soft line break.",
+		"Lenient recoveries should apply to a deferred part")
+	if assert.Equal(t, len(p.Errors()), 1, "Mislabeled encoding should be recorded") {
+		assert.Equal(t, p.Errors()[0].Name, "Mislabeled Encoding", "Error should name the problem")
+	}
+
+	// Decoding that fails after parsing is reported by DecodeError
+	bad := &memMIMEPart{decode: deferredDecoder(false, nil, "base64", []byte("Qm9k!!"))}
+	assert.Equal(t, string(bad.Content()), "Qm9k!!", "Undecodable content should be returned raw")
+	assert.NotNil(t, DecodeError(bad), "Decoding error should be kept")
+	assert.Nil(t, DecodeError(att), "Decoded part should have no error")
+}
+
+func TestDecodeBodyOnlyConcurrent(t *testing.T) {
+	p := &Parser{DecodeBodyOnly: true}
+	mime, err := p.ParseMIMEBody(readMessage("attachment.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	att := mime.Attachments[0]
+	done := make(chan []byte)
+	for i := 0; i < 4; i++ {
+		go func() { done <- att.Content() }()
+	}
+	for i := 0; i < 4; i++ {
+		assert.Contains(t, string(<-done), "<html>", "Every caller should see decoded content")
+	}
+}
+
+func TestPreambleHeader(t *testing.T) {
+	msg := readMessage("preamble-header.raw")
+	p := &Parser{Lenient: true, PreambleAsText: true}
+	mime, err := p.ParseMIMEBody(msg)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Text, "The body text", "Header lines should not become the body")
+	assert.Equal(t, mime.Root.Header().Get("Subject"), "Header after a stray blank line",
+		"Header lines should be moved to the message header")
+	assert.Equal(t, mime.Root.Header().Get("X-Mailer"), "Broken Generator 1.0 (continued)",
+		"Continuation lines should be joined")
+	if assert.Equal(t, len(mime.Errors), 1, "Recovery should be recorded") {
+		assert.Equal(t, mime.Errors[0].Name, "Header In Preamble", "Error should name the problem")
+	}
+}
+
+func TestLooksLikeHeaders(t *testing.T) {
+	assert.True(t, looksLikeHeaders([]byte("\r\nA: 1\r\nB-C:2\r\n\tmore\r\n\r\n")),
+		"Header fields should be recognized")
+	assert.False(t, looksLikeHeaders([]byte("Note: this is a reply\r\n\r\nThanks!")),
+		"Text after a blank line should not be headers")
+	assert.False(t, looksLikeHeaders([]byte("This is a multi-part message in MIME format.")),
+		"Plain preamble should not be headers")
+	assert.False(t, looksLikeHeaders([]byte("\r\n")), "Blank preamble should not be headers")
+}
+
+func TestPartHandler(t *testing.T) {
+	var types []string
+	p := &Parser{PartHandler: func(part MIMEPart) error {
+		types = append(types, part.ContentType()+" in "+part.Parent().ContentType())
+		assert.Nil(t, part.NextSibling(), "Siblings should not be linked")
+		return nil
+	}}
+	root, err := p.ParseMIME(openPart("nestedmulti.raw"))
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Nil(t, root.FirstChild(), "Parts should not be kept in the tree")
+	assert.Equal(t, types, []string{
+		"text/plain in multipart/alternative",
+		"multipart/related in multipart/alternative",
+		"text/html in multipart/related",
+		"text/plain in multipart/related",
+		"text/plain in multipart/related",
+	}, "Parts should be passed in document order")
+
+	stop := errors.New("stop")
+	p = &Parser{PartHandler: func(part MIMEPart) error { return stop }}
+	_, err = p.ParseMIME(openPart("nestedmulti.raw"))
+	assert.Equal(t, err, stop, "Handler error should abort the parse")
+}
+
+// manyParts returns a multipart message with n small base64 attachments.
+func manyParts(n int) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("Content-Type: multipart/mixed; boundary=\"Enmime-Many\"\r\n\r\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(buf, "--Enmime-Many\r\n"+
+			"Content-Type: application/octet-stream\r\n"+
+			"Content-Disposition: attachment; filename=part%v.bin\r\n"+
+			"Content-Transfer-Encoding: base64\r\n\r\n"+
+			"%v\r\n", i, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{byte(i)}, 1024)))
+	}
+	buf.WriteString("--Enmime-Many--\r\n")
+	return buf.Bytes()
+}
+
+// retainedHeap returns the heap in use after a garbage collection.
+func retainedHeap() uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// benchmarkManyParts parses a message with many parts, reporting the heap still retained by
+// the result in addition to the allocations.
+func benchmarkManyParts(b *testing.B, p *Parser) {
+	raw := manyParts(2000)
+	b.ReportAllocs()
+	var retained uint64
+	for i := 0; i < b.N; i++ {
+		before := retainedHeap()
+		root, err := p.ParseMIME(bufio.NewReader(bytes.NewReader(raw)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if after := retainedHeap(); after > before {
+			retained += after - before
+		}
+		runtime.KeepAlive(root)
+	}
+	b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+}
+
+func BenchmarkParseManyParts(b *testing.B) {
+	benchmarkManyParts(b, new(Parser))
+}
+
+func BenchmarkPartHandlerManyParts(b *testing.B) {
+	benchmarkManyParts(b, &Parser{PartHandler: func(part MIMEPart) error { return nil }})
+}
+
+func TestKeepRawContent(t *testing.T) {
+	p := &Parser{KeepRawContent: true}
+	root, err := p.ParseMIME(openPart("multibase64.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Nil(t, RawContent(root), "Multipart root has no raw content")
+	text := root.FirstChild()
+	assert.Equal(t, string(RawContent(text)), "A text section", "Expected raw text")
+	html := text.NextSibling()
+	assert.Equal(t, string(RawContent(html)), "PGh0bWw+Cg==\n", "Raw content should be encoded")
+	assert.Equal(t, string(html.Content()), "<html>\n", "Content should still be decoded")
+
+	root, err = p.ParseMIME(openPart("quoted-printable.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(RawContent(root)), "Start=3D=41=42=\n=43=3DFinish=\n",
+		"Raw content should be encoded")
+	assert.Equal(t, string(root.Content()), "Start=ABC=Finish", "Content should be decoded")
+
+	p = &Parser{KeepRawContent: true, DecodeBodyOnly: true}
+	root, err = p.ParseMIME(openPart("multibase64.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(RawContent(root.FirstChild().NextSibling())), "PGh0bWw+Cg==\n",
+		"Deferred part should keep its raw content")
+
+	root, err = ParseMIME(openPart("multibase64.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Nil(t, RawContent(root.FirstChild()), "Raw content should not be kept by default")
+}
+
+func TestBytesRead(t *testing.T) {
+	raw := readRaw("html-mime-inline.raw")
+	p := new(Parser)
+	_, err := p.ParseMIME(bufio.NewReader(bytes.NewReader(raw)))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.BytesRead(), int64(len(raw)), "Whole message should be counted")
+
+	_, err = p.ParseWithContext(context.Background(), bytes.NewReader(raw))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.BytesRead(), int64(len(raw)), "Whole message should be counted")
+
+	msg := readMessage("html-mime-inline.raw")
+	_, err = p.ParseMIMEBody(msg)
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	body := len(raw) - bytes.Index(raw, []byte("\r\n\r\n")) - 4
+	assert.Equal(t, p.BytesRead(), int64(body), "Only the body should be counted")
+}
+
+func TestBytesReadConcatenated(t *testing.T) {
+	first := "Subject: One\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\n" + strings.Repeat("First\r\n", 1000) +
+		"--b--\r\n"
+	second := "Subject: Two\r\nContent-Type: text/plain\r\n\r\nSecond\r\n"
+	r := bufio.NewReader(strings.NewReader(first + second))
+
+	p := new(Parser)
+	root, err := p.ParseMIME(r)
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, root.Header().Get("Subject"), "One", "First message")
+	assert.Equal(t, p.BytesRead(), int64(len(first)), "Count should end with the first message")
+
+	root, err = p.ParseMIME(r)
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, root.Header().Get("Subject"), "Two", "Second message should be left unread")
+	assert.Equal(t, string(root.Content()), "Second\r\n", "Second message content")
+	assert.Equal(t, p.BytesRead(), int64(len(second)), "Count should cover the second message")
+
+	_, err = p.ParseWithContext(context.Background(), strings.NewReader(first+second))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.BytesRead(), int64(len(first)), "Read ahead should not be counted")
+}
+
+func TestParseAttachedMessages(t *testing.T) {
+	p := &Parser{ParseAttachedMessages: true}
+	mime, err := p.ParseMIMEBody(readMessage("attached-eml.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Text, "See the attached message.", "Text should be the outer body")
+	if !assert.Equal(t, len(mime.Attachments), 1, "Should have the .eml attachment") {
+		t.FailNow()
+	}
+	attached := mime.Attachments[0].FirstChild()
+	if assert.NotNil(t, attached, "Mislabeled .eml should be parsed") {
+		assert.Equal(t, attached.Parent(), mime.Attachments[0], "Parent should be the attachment")
+		assert.Equal(t, attached.Header().Get("Subject"), "Saved message", "Attached header")
+		assert.Equal(t, string(attached.Content()), "Saved body\r\n", "Attached content")
+	}
+
+	mime, err = ParseMIMEBody(readMessage("attached-eml.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Nil(t, mime.Attachments[0].FirstChild(), "Should not be parsed by default")
+
+	mime, err = p.ParseMIMEBody(readMessage("forwarded.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, len(mime.Attachments), 2, "Forwarded attachment should be found")
+	assert.Equal(t, len(AllAttachments(mime.Root)), 2, "Forwarded attachment counted once")
+}
+
+func TestParseAttachedMessagesPlain(t *testing.T) {
+	attached := "Subject: Plain\r\n\r\nPlain body"
+	klingon := "Subject: Klingon\r\nContent-Type: text/plain; charset=x-klingon\r\n\r\nQapla'"
+	raw := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nOuter\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\n" + attached + "\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\n" + klingon + "\r\n--b--\r\n"
+	parse := func(p *Parser) (*MIMEBody, error) {
+		msg, err := mail.ReadMessage(strings.NewReader(raw))
+		if !assert.Nil(t, err, "Reading should not have generated an error") {
+			t.FailNow()
+		}
+		return p.ParseMIMEBody(msg)
+	}
+
+	p := &Parser{ParseAttachedMessages: true}
+	mime, err := parse(p)
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	plain := mime.Root.FirstChild().NextSibling().FirstChild()
+	if assert.NotNil(t, plain, "Message without Content-Type should be parsed") {
+		assert.Equal(t, plain.ContentType(), "text/plain", "Should default to text/plain")
+		assert.Equal(t, string(plain.Content()), "Plain body", "Attached content")
+	}
+	assert.Equal(t, p.UnknownCharsets(), []string{"x-klingon"},
+		"Unknown charsets of attached messages should be kept")
+
+	// Attached messages share the MaxTotalSize of the enclosing message
+	size := int64(len("Outer") + len(attached) + len("Plain body") + len(klingon) +
+		len("Qapla'"))
+	p = &Parser{ParseAttachedMessages: true, MaxTotalSize: size}
+	_, err = parse(p)
+	assert.Nil(t, err, "Parsing within the limit should not have generated an error")
+	p = &Parser{ParseAttachedMessages: true, MaxTotalSize: size - 1}
+	_, err = parse(p)
+	_, ok := err.(*LimitError)
+	assert.True(t, ok, "Attached content should count against the limit")
+}
@@ -4,12 +4,18 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/base64"
-	"github.com/sloonz/go-qprintable"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net/textproto"
+	"net/url"
+	"regexp"
 	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
 // MIMEPart is the primary interface enmine clients will use.  Each MIMEPart represents
@@ -39,7 +45,15 @@ type memMIMEPart struct {
 	contentType string
 	disposition string
 	fileName    string
+	charset     string
 	content     []byte
+	rawContent  []byte                 // Undecoded content, if kept by the Parser
+	decode      func() ([]byte, error) // Decodes content on first use, see DecodeBodyOnly
+	decodeOnce  sync.Once              // Guards decode, decodeErr and content while deferred
+	decodeErr   error                  // Error returned by decode, see DecodeError
+	measured    bool                   // Whether size and sizeErr were set while parsing
+	size        int64                  // Transfer decoded size of the content, see DecodedSize
+	sizeErr     error                  // Why the content failed to transfer decode, if it did
 }
 
 // NewMIMEPart creates a new memMIMEPart object.  It does not update the parents FirstChild
@@ -85,122 +99,937 @@ func (p *memMIMEPart) FileName() string {
 
 // Decoded content of this part (can be empty)
 func (p *memMIMEPart) Content() []byte {
+	p.decodeOnce.Do(p.decodeDeferred)
 	return p.content
 }
 
+// decodeDeferred decodes content deferred by DecodeBodyOnly, if any.  It must only be called
+// through decodeOnce.
+func (p *memMIMEPart) decodeDeferred() {
+	if p.decode != nil {
+		p.content, p.decodeErr = p.decode()
+		p.decode = nil
+	}
+}
+
+// DecodeError returns the error from decoding the content of a part deferred by
+// Parser.DecodeBodyOnly, decoding it first if Content has not been called yet.  Content that
+// fails to decode is returned undecoded by Content.  It returns nil for parts whose content
+// decoded, or was not deferred.
+func DecodeError(p MIMEPart) error {
+	if part, ok := p.(*memMIMEPart); ok {
+		part.decodeOnce.Do(part.decodeDeferred)
+		return part.decodeErr
+	}
+	return nil
+}
+
 // ParseMIME reads a MIME document from the provided reader and parses it into
 // tree of MIMEPart objects.
 func ParseMIME(reader *bufio.Reader) (MIMEPart, error) {
-	tr := textproto.NewReader(reader)
-	header, err := tr.ReadMIMEHeader()
+	return new(Parser).ParseMIME(reader)
+}
+
+// ParseMIME reads a MIME document from the provided reader and parses it into tree of
+// MIMEPart objects using the options set on the Parser.
+func (p *Parser) ParseMIME(reader *bufio.Reader) (MIMEPart, error) {
+	p.bytesRead = 0
+	head, err := readHeaderLines(reader)
+	p.bytesRead = int64(len(head))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(head))).ReadMIMEHeader()
 	if err != nil {
 		return nil, err
 	}
-	mediatype, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	body := p.reset(p.messageBody(reader, header.Get("Content-Type")))
+	defer func() { p.bytesRead += p.counter.n }()
+	mediatype, params, err := parseMediaType(header.Get("Content-Type"))
 	if err != nil {
 		return nil, err
 	}
+	mediatype = p.aliasMediaType(mediatype, params)
 	root := &memMIMEPart{header: header, contentType: mediatype}
 
 	if strings.HasPrefix(mediatype, "multipart/") {
 		boundary := params["boundary"]
-		err = parseParts(root, reader, boundary)
+		err = p.parseParts(root, body, boundary)
 		if err != nil {
 			return nil, err
 		}
 	} else {
 		// Content is text or data, decode it
-		content, err := decodeSection(header.Get("Content-Transfer-Encoding"), reader)
+		tee, raw := p.teeRaw(body)
+		root.content, root.charset, err = p.decodeContent(mediatype, params,
+			header.Get("Content-Transfer-Encoding"), tee)
 		if err != nil {
 			return nil, err
 		}
-		root.content = content
+		p.recordSize(root)
+		if root.rawContent, err = raw(); err != nil {
+			return nil, err
+		}
+		p.linkYEnc(root)
 	}
 
 	return root, nil
 }
 
 // parseParts recursively parses a mime multipart document.
-func parseParts(parent *memMIMEPart, reader io.Reader, boundary string) error {
+func (p *Parser) parseParts(parent *memMIMEPart, reader io.Reader, boundary string) error {
 	var prevSibling *memMIMEPart
+	parts := 0
+
+	// link inserts part into the tree, unless parts are passed to the PartHandler instead
+	link := func(part *memMIMEPart) {
+		parts++
+		if p.PartHandler != nil {
+			return
+		}
+		if prevSibling != nil {
+			prevSibling.nextSibling = part
+		} else {
+			parent.firstChild = part
+		}
+		prevSibling = part
+	}
+
+	// Watch the start of the body, to tell a multipart without parts from a missing boundary
+	start := &bodyStart{closing: []byte("--" + boundary + "--")}
+	reader = io.TeeReader(reader, start)
+	var stray *strayScanner
+	if p.Lenient && parent.parent != nil {
+		// Nested multipart, its epilogue comes before the next boundary of its parent
+		stray = &strayScanner{closing: start.closing, at: -1}
+		reader = io.TeeReader(reader, stray)
+	}
+
+	var preamble []byte
+	if p.Lenient {
+		var rest io.Reader
+		var err error
+		preamble, rest, err = p.readPreamble(reader, boundary)
+		if err != nil {
+			return err
+		}
+		reader = rest
+		if parent.parent == nil && looksLikeHeaders(preamble) {
+			// Broken generators may emit a blank line in the middle of the message header
+			header, err := ParseHeaderBlock(bytes.TrimSpace(preamble))
+			if err != nil {
+				return err
+			}
+			if parent.header == nil {
+				parent.header = make(textproto.MIMEHeader)
+			}
+			for key, values := range header {
+				for _, value := range values {
+					parent.header.Add(key, value)
+				}
+			}
+			p.addError("Header In Preamble",
+				"Moved %v header fields found before the first boundary to the message header",
+				len(header))
+			preamble = nil
+		} else if p.PreambleAsText && len(bytes.TrimSpace(preamble)) > 0 {
+			part := NewMIMEPart(parent, "text/plain")
+			part.header = textproto.MIMEHeader{"Content-Type": {"text/plain"}}
+			part.content = preamble
+			p.total += int64(len(preamble))
+			link(part)
+			if err := p.handlePart(part); err != nil {
+				return err
+			}
+			preamble = nil
+		}
+	}
 
 	// Loop over MIME parts
 	mr := multipart.NewReader(reader, boundary)
 	for {
-		// mrp is go's build in mime-part
-		mrp, err := mr.NextPart()
+		if p.ctx != nil && p.ctx.Err() != nil {
+			return p.ctx.Err()
+		}
+		// mrp is go's build in mime-part, raw so that quoted-printable is left to decodeSection
+		mrp, err := mr.NextRawPart()
 		if err != nil {
+			if parts == 0 && errors.Is(err, io.EOF) && start.empty() {
+				// Closing boundary without any parts, or no body at all
+				p.addError("Empty Multipart", "Multipart %v has no parts", parent.contentType)
+				break
+			}
+			if parts == 0 && errors.Is(err, io.EOF) && p.Lenient {
+				// The boundary never appears, keep the body as text rather than lose it
+				p.addError("Missing Boundary", "Boundary of multipart %v not found, "+
+					"using the body as text", parent.contentType)
+				if len(bytes.TrimSpace(preamble)) > 0 {
+					part := NewMIMEPart(parent, "text/plain")
+					part.header = textproto.MIMEHeader{"Content-Type": {"text/plain"}}
+					part.content = preamble
+					p.total += int64(len(preamble))
+					link(part)
+					if err := p.handlePart(part); err != nil {
+						return err
+					}
+				}
+				break
+			}
 			if err == io.EOF {
 				// This is a clean end-of-message signal
 				break
 			}
 			return err
 		}
-		mediatype, mparams, err := mime.ParseMediaType(mrp.Header.Get("Content-Type"))
+		mediatype, mparams, err := parseMediaType(mrp.Header.Get("Content-Type"))
 		if err != nil {
 			return err
 		}
+		mediatype = p.aliasMediaType(mediatype, mparams)
 
-		// Insert ourselves into tree, p is go-mime's mime-part
-		p := NewMIMEPart(parent, mediatype)
-		if prevSibling != nil {
-			prevSibling.nextSibling = p
-		} else {
-			parent.firstChild = p
-		}
-		prevSibling = p
+		// Insert ourselves into tree, part is go-mime's mime-part
+		part := NewMIMEPart(parent, mediatype)
+		part.header = mrp.Header
+		link(part)
 
 		// Figure out our disposition, filename
-		disposition, dparams, err := mime.ParseMediaType(mrp.Header.Get("Content-Disposition"))
+		disposition, dparams, err := p.parseDisposition(mrp.Header.Get("Content-Disposition"))
 		if err == nil {
 			// Disposition is optional
-			p.disposition = disposition
-			p.fileName = dparams["filename"]
-		}
-		if p.fileName == "" && mparams["name"] != "" {
-			p.fileName = mparams["name"]
+			part.disposition = disposition
 		}
+		part.fileName = fileName(mrp.Header, mparams, dparams)
 
 		boundary := mparams["boundary"]
 		if boundary != "" {
-			// Content is another multipart
-			err = parseParts(p, mrp, boundary)
+			// Content is another multipart, handled before its children
+			if err := p.handlePart(part); err != nil {
+				return err
+			}
+			err = p.parseParts(part, mrp, boundary)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if p.isDisallowed(part) {
+			// Leave content empty, multipart reader skips the unread data
+			p.addError("Attachment Dropped", "Disallowed attachment %q of type %v",
+				part.fileName, part.contentType)
+		} else if p.isDeferred(part) && !p.NoDecode {
+			// Keep the encoded content, it will be decoded when first requested
+			encoding := mrp.Header.Get("Content-Transfer-Encoding")
+			tee, raw := p.teeRaw(mrp)
+			encoded, err := p.readContent(tee)
 			if err != nil {
 				return err
 			}
+			// Decoding it now without keeping the result finds its size and any error
+			part.size, part.sizeErr = p.DecodedSize(encoding, bytes.NewReader(encoded))
+			part.measured = true
+			switch {
+			case part.sizeErr == nil:
+				part.decode = deferredDecoder(p.Lenient, p.qpDecoder(), encoding, encoded)
+			case !p.Lenient:
+				return part.sizeErr
+			default:
+				// Decode malformed content now, so the lenient recoveries are recorded
+				p.total -= int64(len(encoded))
+				part.content, err = p.decodeSection(encoding, bytes.NewReader(encoded))
+				if err != nil {
+					return err
+				}
+				part.size, part.sizeErr = int64(len(part.content)), nil
+			}
+			part.charset = cleanCharset(mparams["charset"])
+			if part.rawContent, err = raw(); err != nil {
+				return err
+			}
 		} else {
 			// Content is text or data, decode it
-			data, err := decodeSection(mrp.Header.Get("Content-Transfer-Encoding"), mrp)
+			tee, raw := p.teeRaw(mrp)
+			part.content, part.charset, err = p.decodeContent(mediatype, mparams,
+				mrp.Header.Get("Content-Transfer-Encoding"), tee)
 			if err != nil {
 				return err
 			}
-			p.content = data
+			p.recordSize(part)
+			if part.rawContent, err = raw(); err != nil {
+				return err
+			}
+			p.linkYEnc(part)
+			if p.ParseAttachedMessages && !p.NoDecode && isAttachedMessage(part) {
+				if err := p.parseAttachedMessage(part); err != nil {
+					return err
+				}
+			}
+		}
+		if err := p.handlePart(part); err != nil {
+			return err
+		}
+	}
+
+	if stray != nil {
+		// Read the rest of the body through the scanner, the multipart reader skips it
+		if _, err := io.Copy(ioutil.Discard, reader); err != nil {
+			return err
+		}
+		if stray.at >= 0 {
+			p.addError("Stray Bytes", "%v bytes after the closing delimiter of multipart %v, "+
+				"from byte %v of its body", stray.n-stray.closedAt, parent.contentType, stray.at)
+		}
+	}
+	return nil
+}
+
+// strayScanner receives the body of a nested multipart as it is read in lenient mode, locating
+// any content after its closing delimiter.  Such bytes are allowed as an epilogue at the end of
+// a message, but before the next boundary of the parent they are the mark of a generator that
+// does not delimit its parts cleanly.
+type strayScanner struct {
+	closing  []byte // Closing delimiter of the multipart
+	line     []byte // Start of the current line, up to the length of closing
+	n        int64  // Bytes received so far
+	closedAt int64  // Offset just past the closing delimiter line, 0 until seen
+	at       int64  // Offset of the first byte after it that is not whitespace, -1 if none
+}
+
+// Write implements io.Writer.
+func (s *strayScanner) Write(p []byte) (int, error) {
+	for _, c := range p {
+		s.n++
+		switch {
+		case s.closedAt > 0:
+			if s.at < 0 && c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+				s.at = s.n - 1
+			}
+		case c == '\n':
+			if bytes.Equal(s.line, s.closing) {
+				s.closedAt = s.n
+			}
+			s.line = s.line[:0]
+		case len(s.line) < len(s.closing):
+			s.line = append(s.line, c)
+		}
+	}
+	return len(p), nil
+}
+
+// mediaTypeAliases maps nonstandard content types emitted by broken clients to the multipart
+// type they intend.
+var mediaTypeAliases = map[string]string{
+	"application/alternative": "multipart/alternative",
+	"multipart/x-alternative": "multipart/alternative",
+	"multipart/alternate":     "multipart/alternative",
+}
+
+// aliasMediaType returns the multipart type intended by a nonstandard mediatype listed in
+// mediaTypeAliases, recording the substitution in the Errors.  The alias only applies when the
+// Content-Type has a boundary; any other mediatype is returned unchanged.
+func (p *Parser) aliasMediaType(mediatype string, params map[string]string) string {
+	alias := mediaTypeAliases[mediatype]
+	if alias == "" || params["boundary"] == "" {
+		return mediatype
+	}
+	p.addError("Nonstandard Type", "Treating %v as %v", mediatype, alias)
+	return alias
+}
+
+// fileName determines the file name of a part from its header, given the parameters of its
+// Content-Type and Content-Disposition, either of which may be nil.
+func fileName(header textproto.MIMEHeader, mparams, dparams map[string]string) string {
+	name := dparams["filename"]
+	if name == "" {
+		name = mparams["name"]
+	}
+	if name == "" {
+		name = extValue(header.Get("Content-Disposition"), filenameExt)
+	}
+	if name == "" {
+		name = extValue(header.Get("Content-Type"), nameExt)
+	}
+	// Non-standard, but many clients encode file names like other header text
+	return DecodeHeader(name)
+}
+
+// boundaryParam matches the boundary parameter of a raw Content-Type header value.
+var boundaryParam = regexp.MustCompile(`(?i)(?:^|;)\s*boundary\s*=\s*(?:"([^"]*)"|([^;]*))`)
+
+// parseMediaType parses a Content-Type header value like mime.ParseMediaType, but tolerates
+// parameters with invalid syntax.  If a multipart type ends up without a boundary parameter,
+// the boundary is recovered by scanning the raw header value.  The obsolete form without a
+// subtype found in some ancient mail is normalized: "text" becomes text/plain, and any other
+// type such as "image" gets the generic subtype "*".
+func parseMediaType(ctype string) (mediatype string, params map[string]string, err error) {
+	mediatype, params, err = mime.ParseMediaType(ctype)
+	if err == mime.ErrInvalidMediaParameter {
+		err = nil
+		params = lenientParams(ctype)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if mediatype == "text" {
+		mediatype = "text/plain"
+	} else if !strings.Contains(mediatype, "/") {
+		mediatype += "/*"
+	}
+	if strings.HasPrefix(mediatype, "multipart/") && params["boundary"] == "" {
+		if m := boundaryParam.FindStringSubmatch(ctype); m != nil {
+			params["boundary"] = strings.TrimSpace(m[1] + m[2])
+		}
+	}
+	return mediatype, params, nil
+}
+
+// extParam holds the patterns matching the RFC 2231 extended form of one parameter, with and
+// without the charset and language.
+type extParam struct {
+	full, bare *regexp.Regexp
+}
+
+// newExtParam compiles the extended form patterns for the named parameter.
+func newExtParam(name string) extParam {
+	prefix := `(?i)(?:^|;)\s*` + regexp.QuoteMeta(name) + `\*\s*=\s*"?`
+	return extParam{
+		full: regexp.MustCompile(prefix + `([^';"]*)'[^']*'([^;"\s]*)`),
+		bare: regexp.MustCompile(prefix + `([^';"\s]*%[0-9a-f]{2}[^';"\s]*)`),
+	}
+}
+
+// Extended form patterns for the file name parameters, compiled once.
+var (
+	filenameExt = newExtParam("filename")
+	nameExt     = newExtParam("name")
+)
+
+// extValue decodes the single segment RFC 2231 extended form of the parameter param, such as
+// filename*=iso-8859-1'fr'caf%E9.txt, from a raw header value.  mime.ParseMediaType only
+// decodes this form for UTF-8 and US-ASCII, dropping the parameter for any other charset.
+// Some webmail clients leave out the charset and language, as in filename*=%E2%9C%93.txt; such
+// a value is assumed to be UTF-8.  It returns "" if the parameter is missing or cannot be
+// decoded.
+func extValue(value string, param extParam) string {
+	m := param.full.FindStringSubmatch(value)
+	if m == nil {
+		if m = param.bare.FindStringSubmatch(value); m == nil {
+			return ""
+		}
+		raw, err := url.PathUnescape(m[1])
+		if err != nil || !utf8.ValidString(raw) {
+			return ""
+		}
+		return raw
+	}
+	raw, err := url.PathUnescape(m[2])
+	if err != nil {
+		return ""
+	}
+	decoder, err := charsetDecoder(m[1])
+	if err != nil {
+		return ""
+	}
+	if decoder == nil {
+		return raw
+	}
+	decoded, err := decoder.String(raw)
+	if err != nil {
+		return ""
+	}
+	return decoded
+}
+
+// parseDisposition parses a Content-Disposition header value like mime.ParseMediaType.  A
+// parameter given more than once, such as two filename parameters, makes ParseMediaType fail;
+// instead the first occurrence is used and the duplicates are recorded in the Errors.
+func (p *Parser) parseDisposition(value string) (string, map[string]string, error) {
+	disposition, params, err := mime.ParseMediaType(value)
+	if err == nil {
+		return disposition, params, nil
+	}
+	deduped, dupes := dedupeParams(value)
+	if len(dupes) > 0 {
+		p.addError("Duplicate Parameter", "Content-Disposition repeats %v, using the first",
+			strings.Join(dupes, ", "))
+		disposition, params, err = mime.ParseMediaType(deduped)
+	}
+	if err == mime.ErrInvalidMediaParameter {
+		return disposition, lenientParams(deduped), nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return disposition, params, nil
+}
+
+// lenientParams parses the parameters of a raw header value that mime.ParseMediaType rejects,
+// as sent by clients that leave values with spaces unquoted, such as name=My Document.pdf.  An
+// unquoted value extends to the next semicolon or the end of the value, so it is recovered in
+// full instead of stopping at the first space.  Parameter names are lower cased, the first of
+// repeated parameters is kept, and fields without an equals sign are ignored.
+func lenientParams(value string) map[string]string {
+	params := make(map[string]string)
+	fields := splitUnquoted(value, ';')
+	for _, field := range fields[1:] {
+		eq := strings.Index(field, "=")
+		if eq < 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(field[:eq]))
+		v := strings.TrimSpace(field[eq+1:])
+		if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+			v = unquote(v[1 : len(v)-1])
+		}
+		if _, ok := params[name]; name != "" && !ok {
+			params[name] = v
+		}
+	}
+	return params
+}
+
+// dedupeParams removes parameters whose name repeats that of an earlier parameter from a raw
+// header value, returning the new value along with the names of the removed parameters.
+func dedupeParams(value string) (string, []string) {
+	fields := splitUnquoted(value, ';')
+	kept := fields[:1]
+	seen := make(map[string]bool)
+	var dupes []string
+	for _, field := range fields[1:] {
+		name := field
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name = name[:eq]
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if seen[name] {
+			dupes = append(dupes, name)
+			continue
+		}
+		seen[name] = true
+		kept = append(kept, field)
+	}
+	return strings.Join(kept, ";"), dupes
+}
+
+// unquote removes the backslash escapes from the content of a quoted string.
+func unquote(s string) string {
+	var unquoted []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		unquoted = append(unquoted, s[i])
+	}
+	return string(unquoted)
+}
+
+// splitUnquoted splits s at each sep that is not inside a quoted string.
+func splitUnquoted(s string, sep byte) []string {
+	var fields []string
+	quoted, escaped := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			fields = append(fields, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, s[start:])
+}
+
+// ContentTypeString returns the full Content-Type header value of the part, its content type
+// followed by the parameters of its Content-Type header, formatted canonically by
+// mime.FormatMediaType: the type and parameter names are lower cased, parameters are sorted
+// and values are quoted or RFC 2231 encoded as needed.  If the parameters cannot be
+// formatted, only the content type is returned.
+func ContentTypeString(p MIMEPart) string {
+	if p.ContentType() == "" {
+		return ""
+	}
+	_, params, err := parseMediaType(p.Header().Get("Content-Type"))
+	if err != nil {
+		params = nil
+	}
+	if value := mime.FormatMediaType(p.ContentType(), params); value != "" {
+		return value
+	}
+	return p.ContentType()
+}
+
+// Charset returns the charset of the decoded content of the part: "utf-8" once the parser has
+// converted text to UTF-8, otherwise the charset the text was left in, lower cased.  It returns
+// "" for content that is not text or has no charset, and for parts not created by the parser.
+func Charset(p MIMEPart) string {
+	if part, ok := p.(*memMIMEPart); ok {
+		return part.charset
+	}
+	return ""
+}
+
+// RawContentType returns the Content-Type header value of the part as sent, before any
+// parsing or normalization, for diagnosing parts whose ContentType or Charset look wrong.  The
+// value of a folded header has its lines joined, as by textproto, and only the first of
+// repeated Content-Type headers is returned.  It returns "" if the header is missing.
+func RawContentType(p MIMEPart) string {
+	return p.Header().Get("Content-Type")
+}
+
+// ContentAs returns the decoded content of the part only if its content type matches
+// expectedType, guarding code that assumes a kind of content against receiving another.  The
+// expected type may use a wildcard subtype such as "image/*", or be "*/*" to accept any type;
+// types are compared case insensitively.  An error naming both types is returned on mismatch.
+func ContentAs(p MIMEPart, expectedType string) ([]byte, error) {
+	expected := strings.ToLower(strings.TrimSpace(expectedType))
+	ctype := strings.ToLower(p.ContentType())
+	if expected != "*/*" && expected != ctype && !(strings.HasSuffix(expected, "/*") &&
+		strings.HasPrefix(ctype, strings.TrimSuffix(expected, "*"))) {
+		return nil, fmt.Errorf("Content type %v does not match expected %v", ctype, expectedType)
+	}
+	return p.Content(), nil
+}
+
+// readPreamble reads the content preceding the first boundary line from reader.  It returns
+// the preamble without its trailing line break, and a reader positioned at the boundary line.
+// With MaxTotalSize set, no more of the preamble is kept than the bytes remaining under the
+// limit; the rest is skipped while looking for the boundary, and recorded in the Errors.
+func (p *Parser) readPreamble(reader io.Reader, boundary string) ([]byte, io.Reader, error) {
+	br := bufio.NewReader(reader)
+	dashBoundary := []byte("--" + boundary)
+	preamble := new(bytes.Buffer)
+	room := int64(-1) // Bytes that may still be kept, -1 if unlimited
+	if p.MaxTotalSize > 0 {
+		room = p.MaxTotalSize - p.total
+		if room < 0 {
+			room = 0
+		}
+	}
+	start := true // line starts a line, rather than continuing one longer than the buffer
+	truncated := false
+	for {
+		line, err := br.ReadSlice('\n')
+		if start && bytes.HasPrefix(line, dashBoundary) {
+			// Copy the line, as the next read from br overwrites it
+			line = append([]byte(nil), line...)
+			return trimNewline(preamble.Bytes()), io.MultiReader(bytes.NewReader(line), br), nil
+		}
+		if room >= 0 && int64(len(line)) > room {
+			if !truncated {
+				truncated = true
+				p.addError("Size Limit Exceeded", "Preamble truncated to %v bytes",
+					int64(preamble.Len())+room)
+			}
+			line = line[:room]
+		}
+		preamble.Write(line)
+		if room >= 0 {
+			room -= int64(len(line))
+		}
+		start = err != bufio.ErrBufferFull
+		if err == io.EOF {
+			return trimNewline(preamble.Bytes()), br, nil
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return nil, nil, err
+		}
+	}
+}
+
+// bodyStart receives the body of a multipart as it is read, keeping just enough of its
+// start to tell whether it holds anything besides whitespace and the closing delimiter.
+type bodyStart struct {
+	closing []byte // Closing delimiter of the multipart
+	seen    []byte // Leading bytes after any whitespace, up to the length of closing
+}
+
+// Write implements io.Writer.
+func (b *bodyStart) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if len(b.seen) == len(b.closing) {
+			break
+		}
+		if len(b.seen) > 0 || c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			b.seen = append(b.seen, c)
 		}
 	}
+	return len(p), nil
+}
+
+// empty returns true if the body read so far is whitespace, optionally followed by the
+// closing delimiter.
+func (b *bodyStart) empty() bool {
+	return len(b.seen) == 0 || bytes.Equal(b.seen, b.closing)
+}
+
+// trimNewline removes a single trailing CRLF or LF from b.
+func trimNewline(b []byte) []byte {
+	if bytes.HasSuffix(b, []byte("\r\n")) {
+		return b[:len(b)-2]
+	}
+	return bytes.TrimSuffix(b, []byte("\n"))
+}
+
+// decodeContent decodes the content of a leaf part read from reader according to its
+// Content-Transfer-Encoding and charset, and applies KeepBOM and TrimTextParts, returning the
+// content along with the charset it is now in.  With NoDecode set the content is returned
+// exactly as read.
+func (p *Parser) decodeContent(mediatype string, params map[string]string, encoding string,
+	reader io.Reader) ([]byte, string, error) {
+	p.checkCharset(mediatype, params["charset"])
+	if p.NoDecode {
+		content, err := p.readContent(reader)
+		if err == nil {
+			p.size, p.sizeErr = p.DecodedSize(encoding, bytes.NewReader(content))
+		}
+		return content, cleanCharset(params["charset"]), err
+	}
+	content, err := p.decodeSection(encoding, reader)
+	if err != nil {
+		return nil, "", err
+	}
+	p.size, p.sizeErr = int64(len(content)), nil
+	p.findYEnc(mediatype, content)
+	content, charset := p.convertCharset(mediatype, params["charset"], content)
+	content = p.stripBOM(mediatype, charset, content)
+	return p.trimText(mediatype, content), charset, nil
+}
+
+// recordSize sets the transfer decoded size of part to that found by the last decodeContent.
+func (p *Parser) recordSize(part *memMIMEPart) {
+	part.size, part.sizeErr, part.measured = p.size, p.sizeErr, true
+}
 
+// RawContent returns the content of the part exactly as it appears in the message, still
+// transfer encoded and in its original charset, for example to verify a signature over it while
+// displaying the decoded Content.  It is only available for leaf parts parsed by a Parser with
+// KeepRawContent set, otherwise it returns nil.
+func RawContent(p MIMEPart) []byte {
+	if part, ok := p.(*memMIMEPart); ok {
+		return part.rawContent
+	}
 	return nil
 }
 
+// teeRaw returns the reader to decode the content of a part from, and a function returning
+// the raw bytes read through it when KeepRawContent is set, or nil otherwise.  The raw bytes
+// are captured as they are decoded, in a single pass over the message.  Capturing what the
+// decoder left unread is bounded like readRaw; beyond that the raw bytes are truncated in
+// lenient mode, or a LimitError is returned.
+func (p *Parser) teeRaw(reader io.Reader) (io.Reader, func() ([]byte, error)) {
+	if !p.KeepRawContent {
+		return reader, func() ([]byte, error) { return nil, nil }
+	}
+	buf := new(bytes.Buffer)
+	tee := io.TeeReader(reader, buf)
+	return tee, func() ([]byte, error) {
+		// Capture anything the decoder left unread
+		if p.MaxTotalSize <= 0 {
+			_, err := io.Copy(ioutil.Discard, tee)
+			return buf.Bytes(), err
+		}
+		limit := 4*(p.MaxTotalSize-p.total) + rawSlack
+		n, err := io.Copy(ioutil.Discard, io.LimitReader(tee, limit+1))
+		if err != nil {
+			return nil, err
+		}
+		if n > limit {
+			if !p.Lenient {
+				return nil, &LimitError{Kind: LimitTotalSize, Limit: p.MaxTotalSize}
+			}
+			buf.Truncate(buf.Len() - 1)
+			p.addError("Size Limit Exceeded", "Raw content truncated to %v bytes", buf.Len())
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+// TransferEncoding returns the Content-Transfer-Encoding of the part in lower case, such as
+// "base64" or "quoted-printable", which has been decoded from its Content unless it was parsed
+// with Parser.NoDecode.  It returns "" if the part has no Content-Transfer-Encoding header.
+func TransferEncoding(p MIMEPart) string {
+	return strings.ToLower(strings.TrimSpace(p.Header().Get("Content-Transfer-Encoding")))
+}
+
 // decodeSection attempts to decode the data from reader using the algorithm listed in
 // the Content-Transfer-Encoding header, returning the raw data if it does not known
 // the encoding type.
-func decodeSection(encoding string, reader io.Reader) ([]byte, error) {
-	// Default is to just read input into bytes
-	decoder := reader
+func (p *Parser) decodeSection(encoding string, reader io.Reader) ([]byte, error) {
+	var raw []byte
+	if p.Lenient && strings.ToLower(encoding) == "base64" {
+		// Keep the raw content in case it turns out not to be base64
+		var err error
+		raw, err = p.readRaw(reader, 2)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(raw)
+	}
+	if p.Lenient && strings.ToLower(encoding) == "quoted-printable" {
+		data, err := p.readRaw(reader, 4)
+		if err != nil {
+			return nil, err
+		}
+		data, count := escapeLiteralEquals(data)
+		if count > 0 {
+			p.addError("Literal Equals", "Kept %v equals signs not starting a quoted-printable "+
+				"escape as is", count)
+		}
+		reader = bytes.NewReader(data)
+	}
+	decoder := p.newDecoder(encoding, reader)
 
+	content, err := p.readContent(decoder)
+	if _, ok := err.(base64.CorruptInputError); ok && raw != nil {
+		if looksLikeQP(raw) {
+			p.addError("Mislabeled Encoding",
+				"Content labeled base64 looks quoted-printable, decoding it as such")
+			return p.readContent(p.newDecoder("quoted-printable", bytes.NewReader(raw)))
+		}
+		if invalidBase64Ratio(raw) > maxInvalidBase64Ratio {
+			// Likely already decoded by an intermediary
+			p.addError("Malformed Base64", "Content does not look base64 encoded, using raw bytes")
+			return p.readContent(bytes.NewReader(raw))
+		}
+	}
+	return content, err
+}
+
+// rawSlack is added to the limit of readRaw, so that short content is never cut.
+const rawSlack = 4096
+
+// readRaw reads the undecoded content of a part that lenient decoding needs at once.  With
+// MaxTotalSize set, no more is read than could decode to the bytes remaining under the limit,
+// allowing factor encoded bytes for each of them, so a huge part cannot exhaust memory before
+// readContent enforces the limit on the decoded content.
+func (p *Parser) readRaw(reader io.Reader, factor int64) ([]byte, error) {
+	if p.MaxTotalSize > 0 {
+		reader = io.LimitReader(reader, factor*(p.MaxTotalSize-p.total)+rawSlack)
+	}
+	return ioutil.ReadAll(reader)
+}
+
+// newDecoder returns a reader that decodes the data from reader according to the
+// Content-Transfer-Encoding encoding, or reader itself if no decoding is required.
+func (p *Parser) newDecoder(encoding string, reader io.Reader) io.Reader {
 	switch strings.ToLower(encoding) {
 	case "quoted-printable":
-		decoder = qprintable.NewDecoder(qprintable.WindowsTextEncoding, reader)
+		return p.qpDecoder().NewDecoder(reader)
 	case "base64":
-		cleaner := NewBase64Cleaner(reader)
-		decoder = base64.NewDecoder(base64.StdEncoding, cleaner)
+		return base64.NewDecoder(base64.StdEncoding, NewBase64Cleaner(reader))
+	}
+	return reader
+}
+
+// deferredDecoder returns a function that decodes the raw content of a part deferred by
+// Parser.DecodeBodyOnly like decodeSection, applying the lenient recoveries when lenient is
+// set.  Content that fails to decode is returned raw along with the error.
+func deferredDecoder(lenient bool, qp QPDecoder, encoding string,
+	raw []byte) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		p := &Parser{Lenient: lenient, QPDecoder: qp}
+		p.reset(nil)
+		content, err := p.decodeSection(encoding, bytes.NewReader(raw))
+		if err != nil {
+			return raw, err
+		}
+		return content, nil
+	}
+}
+
+// DecodedSize returns the number of bytes the content of the part decodes to from its
+// Content-Transfer-Encoding, before any charset conversion.  The size is measured while
+// parsing, so it is also known for content kept encoded by DecodeBodyOnly or NoDecode, which
+// is streamed through the decoder configured on the Parser without keeping the decoded bytes.
+// An error is returned if that content fails to decode.  For parts not created by the parser,
+// the size of Content is returned.
+func DecodedSize(p MIMEPart) (int64, error) {
+	part, ok := p.(*memMIMEPart)
+	if !ok || !part.measured {
+		return int64(len(p.Content())), nil
+	}
+	return part.size, part.sizeErr
+}
+
+// DecodedSize returns the number of bytes the content read from reader decodes to, given the
+// value of its Content-Transfer-Encoding header, using the decoders configured on the Parser.
+// The content is decoded as it streams through and then discarded, so the size of a large
+// part can be checked against a policy before it is loaded into memory; combine it with
+// ReadHeaders to pre-scan a single part.
+func (p *Parser) DecodedSize(encoding string, reader io.Reader) (int64, error) {
+	return io.Copy(ioutil.Discard, p.newDecoder(encoding, reader))
+}
+
+// DecodeAll returns the decoded content of every leaf part of the tree below root, in
+// document order, for pipelines such as malware scanners that process all parts alike.
+// Multipart containers, and parts holding a message parsed by ParseAttachedMessages, are
+// not leaves.  Content deferred by DecodeBodyOnly is decoded, and the first part that fails
+// to decode is reported as an error.
+func DecodeAll(root MIMEPart) ([][]byte, error) {
+	return new(Parser).DecodeAll(root)
+}
+
+// DecodeAll returns the decoded content of every leaf part like the package level DecodeAll
+// function, enforcing the MaxTotalSize of the Parser over their combined size.  In lenient
+// mode parts that fail to decode are returned undecoded and content is truncated at the size
+// limit instead of failing; the problems are available from the Errors method, which then no
+// longer returns those of the last parse.
+func (p *Parser) DecodeAll(root MIMEPart) ([][]byte, error) {
+	p.reset(nil)
+	var contents [][]byte
+	var walk func(part MIMEPart) error
+	walk = func(part MIMEPart) error {
+		if part.FirstChild() != nil || strings.HasPrefix(part.ContentType(), "multipart/") {
+			for c := part.FirstChild(); c != nil; c = c.NextSibling() {
+				if err := walk(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := DecodeError(part); err != nil {
+			if !p.Lenient {
+				return fmt.Errorf("Part %v: %v", PathIndex(part), err)
+			}
+			p.addError("Malformed Content", "Part %v returned undecoded: %v",
+				PathIndex(part), err)
+		}
+		limited, err := p.readContent(bytes.NewReader(part.Content()))
+		if err != nil {
+			return err
+		}
+		contents = append(contents, limited)
+		return nil
 	}
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
 
-	// Read bytes into buffer
+// readContent reads decoded content from decoder, enforcing MaxTotalSize.
+func (p *Parser) readContent(decoder io.Reader) ([]byte, error) {
+	// Read bytes into buffer, reading one byte past the total size limit to detect overflow
+	if p.MaxTotalSize > 0 {
+		decoder = io.LimitReader(decoder, p.MaxTotalSize-p.total+1)
+	}
 	buf := new(bytes.Buffer)
 	_, err := buf.ReadFrom(decoder)
 	if err != nil {
 		return nil, err
 	}
+	if p.MaxTotalSize > 0 && p.total+int64(buf.Len()) > p.MaxTotalSize {
+		if !p.Lenient {
+			return nil, &LimitError{Kind: LimitTotalSize, Limit: p.MaxTotalSize}
+		}
+		p.addError("Size Limit Exceeded", "Content truncated to %v bytes", p.MaxTotalSize-p.total)
+		buf.Truncate(int(p.MaxTotalSize - p.total))
+	}
+	p.total += int64(buf.Len())
+
 	return buf.Bytes(), nil
 }
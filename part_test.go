@@ -4,8 +4,12 @@ import (
 	"bufio"
 	"fmt"
 	"github.com/stretchrcom/testify/assert"
+	"io"
+	"mime"
+	"net/textproto"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -148,6 +152,36 @@ func TestMultiBase64Parts(t *testing.T) {
 		"Second child should have <html> as decoded content")
 }
 
+func TestInvalidBoundaryParam(t *testing.T) {
+	r := openPart("badboundary.raw")
+	p, err := ParseMIME(r)
+
+	// Examine root
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.ContentType(), "multipart/alternative", "Expected type to be set")
+	if !assert.NotNil(t, p.FirstChild(), "Root should have a FirstChild") {
+		t.FailNow()
+	}
+
+	// Examine first child
+	p = p.FirstChild()
+	assert.Contains(t, string(p.Content()), "A text section", "First child contains wrong content")
+	if !assert.NotNil(t, p.NextSibling(), "First child should have a sibling") {
+		t.FailNow()
+	}
+
+	// Examine nested multipart
+	p = p.NextSibling()
+	assert.Equal(t, p.ContentType(), "multipart/related", "Second child should be multipart")
+	if !assert.NotNil(t, p.FirstChild(), "Second child should have a child") {
+		t.FailNow()
+	}
+	assert.Contains(t, string(p.FirstChild().Content()), "An HTML section",
+		"First nested contains wrong content")
+}
+
 // openPart is a test utility function to open a part as a reader
 func openPart(filename string) *bufio.Reader {
 	// Open test part for parsing
@@ -159,3 +193,366 @@ func openPart(filename string) *bufio.Reader {
 	// Wrap in a buffer
 	return bufio.NewReader(raw)
 }
+
+func TestEmptyMultipartPart(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader(
+		"Content-Type: multipart/mixed; boundary=\"empty\"\r\n\r\n"))
+	p, err := ParseMIME(r)
+
+	if !assert.Nil(t, err, "Parsing a body without boundaries should not generate an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.ContentType(), "multipart/mixed", "Expected type to be set")
+	assert.Nil(t, p.FirstChild(), "Root should have no children")
+}
+
+func TestRFC2231FileName(t *testing.T) {
+	r := openPart("filename2231.raw")
+	p, err := ParseMIME(r)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	p = p.FirstChild()
+	if !assert.NotNil(t, p, "Root should have a FirstChild") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.FileName(), "é.txt", "Starred filename should be decoded")
+
+	p = p.NextSibling()
+	if !assert.NotNil(t, p, "First child should have a sibling") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.FileName(), "résumé.pdf", "Starred name should be decoded")
+
+	p = p.NextSibling()
+	if !assert.NotNil(t, p, "Second child should have a sibling") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.FileName(), "café.txt", "Starred filename in Latin-1 should be decoded")
+
+	p = p.NextSibling()
+	if !assert.NotNil(t, p, "Third child should have a sibling") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.FileName(), "été 2012.txt", "Encoded-word filename should be decoded")
+
+	p = p.NextSibling()
+	if !assert.NotNil(t, p, "Fourth child should have a sibling") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.FileName(), "✓.txt", "Starred filename without charset should be UTF-8")
+}
+
+func TestDecodedSize(t *testing.T) {
+	size, err := new(Parser).DecodedSize("base64", strings.NewReader("aGVs\r\nbG8=\r\n"))
+	assert.Nil(t, err, "Decoding should not have generated an error")
+	assert.Equal(t, size, int64(5), "Base64 content should be measured decoded")
+
+	size, err = new(Parser).DecodedSize("7bit", strings.NewReader("hello"))
+	assert.Nil(t, err, "Reading should not have generated an error")
+	assert.Equal(t, size, int64(5), "Unencoded content should be measured as is")
+
+	r := openPart("quoted-printable.raw")
+	header, err := ReadHeaders(r)
+	if !assert.Nil(t, err, "Reading headers should not have generated an error") {
+		t.FailNow()
+	}
+	size, err = new(Parser).DecodedSize(header.Get("Content-Transfer-Encoding"), r)
+	assert.Nil(t, err, "Decoding should not have generated an error")
+	assert.Equal(t, size, int64(len("Start=ABC=Finish")), "QP content should be measured decoded")
+
+	_, err = new(Parser).DecodedSize("base64", strings.NewReader("not*base64*at*all"))
+	assert.NotNil(t, err, "Corrupt base64 should generate an error")
+}
+
+func TestPartDecodedSize(t *testing.T) {
+	parser := &Parser{DecodeBodyOnly: true}
+	root, err := parser.ParseMIME(openPart("multibase64.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	for p := root.FirstChild(); p != nil; p = p.NextSibling() {
+		size, err := DecodedSize(p)
+		assert.Nil(t, err, "Decoding should not have generated an error")
+		assert.Equal(t, size, int64(len(p.Content())), "Size should be that of the content")
+	}
+
+	parser = &Parser{NoDecode: true}
+	root, err = parser.ParseMIME(openPart("multibase64.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	size, err := DecodedSize(root.FirstChild().NextSibling())
+	assert.Nil(t, err, "Decoding should not have generated an error")
+	assert.Equal(t, size, int64(len("<html>\n")), "Undecoded content should be measured")
+
+	// The QPDecoder of the Parser is used
+	calls := 0
+	parser = &Parser{NoDecode: true, QPDecoder: QPDecoderFunc(func(r io.Reader) io.Reader {
+		calls++
+		return StdQPDecoder.NewDecoder(r)
+	})}
+	_, err = parser.ParseMIME(openPart("quoted-printable.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.True(t, calls > 0, "Configured QPDecoder should measure the size")
+
+	raw := "Content-Type: application/octet-stream\r\nContent-Transfer-Encoding: base64\r\n" +
+		"\r\nnot*base64*at*all\r\n"
+	root, err = parser.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	_, err = DecodedSize(root)
+	assert.NotNil(t, err, "Corrupt base64 should generate an error")
+}
+
+func TestNoDecode(t *testing.T) {
+	p := &Parser{NoDecode: true}
+	root, err := p.ParseMIME(openPart("multibase64.raw"))
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	part := root.FirstChild().NextSibling()
+	if !assert.NotNil(t, part, "Root should have a second child") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(part.Content()), "PGh0bWw+Cg==\n",
+		"Base64 content should not have been decoded")
+	assert.Equal(t, TransferEncoding(part), "base64", "Encoding should still be reported")
+
+	root, err = p.ParseMIME(openPart("quoted-printable.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(root.Content()), "Start=3D=41=42=\n=43=3DFinish=\n",
+		"QP content should not have been decoded")
+	assert.Equal(t, TransferEncoding(root), "quoted-printable",
+		"Encoding should still be reported")
+}
+
+func TestTransferEncoding(t *testing.T) {
+	root, err := ParseMIME(openPart("multibase64.raw"))
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, TransferEncoding(root), "", "Root has no Content-Transfer-Encoding")
+	assert.Equal(t, TransferEncoding(root.FirstChild()), "7bit", "Expected 7bit")
+	assert.Equal(t, TransferEncoding(root.FirstChild().NextSibling()), "base64",
+		"Expected base64")
+}
+
+func TestMissingSubtype(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader(
+		"Content-Type: text; charset=iso-8859-1\r\n\r\ncaf\xe9"))
+	p, err := ParseMIME(r)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.ContentType(), "text/plain", "Bare text should be text/plain")
+	assert.Equal(t, string(p.Content()), "café", "Content should be converted as text")
+
+	r = bufio.NewReader(strings.NewReader("Content-Type: image\r\n\r\nGIF89a"))
+	p, err = ParseMIME(r)
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.ContentType(), "image/*", "Bare image should get a generic subtype")
+}
+
+func TestContentAs(t *testing.T) {
+	p := &memMIMEPart{contentType: "image/png", content: []byte("PNG")}
+
+	content, err := ContentAs(p, "image/png")
+	assert.Nil(t, err, "Exact type should match")
+	assert.Equal(t, string(content), "PNG", "Expected the content")
+	_, err = ContentAs(p, "Image/*")
+	assert.Nil(t, err, "Wildcard subtype should match")
+	_, err = ContentAs(p, "*/*")
+	assert.Nil(t, err, "Wildcard type should match")
+
+	content, err = ContentAs(p, "text/*")
+	if assert.NotNil(t, err, "Other type should generate an error") {
+		assert.Contains(t, err.Error(), "image/png", "Error should name the actual type")
+	}
+	assert.Nil(t, content, "No content should be returned on mismatch")
+	_, err = ContentAs(p, "image/pn")
+	assert.NotNil(t, err, "Partial subtype should not match")
+	_, err = ContentAs(&memMIMEPart{contentType: "imagery/png"}, "image/*")
+	assert.NotNil(t, err, "Wildcard should only match the whole type")
+}
+
+func TestContentTypeString(t *testing.T) {
+	r := openPart("badboundary.raw")
+	p, err := ParseMIME(r)
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	value := ContentTypeString(p)
+	mediatype, params, err := mime.ParseMediaType(value)
+	assert.Nil(t, err, "Content-Type string should parse")
+	assert.Equal(t, mediatype, p.ContentType(), "Content type should round-trip")
+	assert.NotEqual(t, params["boundary"], "", "Boundary should be kept")
+	_, orig, _ := parseMediaType(p.Header().Get("Content-Type"))
+	assert.Equal(t, params["boundary"], orig["boundary"], "Boundary should round-trip")
+
+	part := &memMIMEPart{contentType: "text/plain", header: textproto.MIMEHeader{
+		"Content-Type": {"Text/Plain; CHARSET=\"utf-8\"; format=flowed"}}}
+	assert.Equal(t, ContentTypeString(part), "text/plain; charset=utf-8; format=flowed",
+		"Parameters should be formatted canonically")
+
+	part = &memMIMEPart{contentType: "multipart/mixed", header: textproto.MIMEHeader{
+		"Content-Type": {"multipart/mixed; boundary=\"=_part 1?\""}}}
+	assert.Equal(t, ContentTypeString(part), "multipart/mixed; boundary=\"=_part 1?\"",
+		"Boundary should be quoted")
+
+	part = &memMIMEPart{contentType: "image/png"}
+	assert.Equal(t, ContentTypeString(part), "image/png", "Missing header should give the type")
+}
+
+func TestDecodeAll(t *testing.T) {
+	root := &memMIMEPart{contentType: "multipart/mixed"}
+	text := &memMIMEPart{parent: root, contentType: "text/plain", content: []byte("Body")}
+	bad := &memMIMEPart{parent: root, contentType: "application/octet-stream",
+		decode: deferredDecoder(false, nil, "base64", []byte("Qm9k!!"))}
+	root.firstChild = text
+	text.nextSibling = bad
+
+	_, err := DecodeAll(root)
+	assert.NotNil(t, err, "Part failing to decode should be an error")
+	_, err = DecodeAll(root)
+	assert.NotNil(t, err, "Part failing to decode should still be an error")
+
+	p := &Parser{Lenient: true, MaxTotalSize: 6}
+	contents, err := p.DecodeAll(root)
+	if !assert.Nil(t, err, "Lenient mode should not fail") {
+		t.FailNow()
+	}
+	if assert.Equal(t, len(contents), 2, "Should return every leaf part") {
+		assert.Equal(t, string(contents[0]), "Body", "First part")
+		assert.Equal(t, string(contents[1]), "Qm", "Undecoded content should be truncated")
+	}
+	if assert.Equal(t, len(p.Errors()), 2, "Both problems should be recorded") {
+		assert.Equal(t, p.Errors()[0].Name, "Malformed Content", "Decoding error")
+		assert.Equal(t, p.Errors()[1].Name, "Size Limit Exceeded", "Size limit")
+	}
+
+	_, err = (&Parser{MaxTotalSize: 2}).DecodeAll(text)
+	assert.IsType(t, err, &LimitError{}, "Size limit should fail in strict mode")
+}
+
+func TestUnquotedParameters(t *testing.T) {
+	r := openPart("unquoted-filename.raw")
+	p, err := ParseMIME(r)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	p = p.FirstChild()
+	if !assert.NotNil(t, p, "Root should have a FirstChild") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.FileName(), "My Document.pdf", "Name should not stop at the space")
+
+	p = p.NextSibling()
+	if !assert.NotNil(t, p, "Should have a second part") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.Disposition(), "attachment", "Disposition should be kept")
+	assert.Equal(t, p.FileName(), "Meeting notes v2.txt", "Filename should end at the semicolon")
+	assert.Equal(t, Charset(p), "us-ascii", "Charset should still be parsed")
+
+	params := lenientParams(`attachment; FileName="a \"b\".txt"; filename=c; bare`)
+	assert.Equal(t, params, map[string]string{"filename": `a "b".txt`},
+		"Quoted value should be unescaped and the first kept")
+}
+
+func TestEmptyBodies(t *testing.T) {
+	parsers := map[string]*Parser{
+		"default":    new(Parser),
+		"lenient":    {Lenient: true},
+		"qprintable": {QPDecoder: QPrintableDecoder},
+	}
+	for name, parser := range parsers {
+		root, err := parser.ParseMIME(openPart("empty-bodies.raw"))
+		if !assert.Nil(t, err, "Empty bodies should not be an error with the %v parser", name) {
+			continue
+		}
+		count := 0
+		for p := root.FirstChild(); p != nil; p = p.NextSibling() {
+			assert.Equal(t, len(p.Content()), 0, "%v part should be empty with the %v parser",
+				p.ContentType(), name)
+			count++
+		}
+		assert.Equal(t, count, 4, "Every part should be kept with the %v parser", name)
+		assert.Equal(t, len(parser.Errors()), 0, "Nothing to recover from with the %v parser",
+			name)
+	}
+}
+
+func TestRawContentType(t *testing.T) {
+	r := openPart("unquoted-filename.raw")
+	p, err := ParseMIME(r)
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	p = p.FirstChild()
+	assert.Equal(t, RawContentType(p), "application/pdf; name=My Document.pdf",
+		"Header value should be returned as sent")
+	assert.Equal(t, RawContentType(&memMIMEPart{contentType: "text/plain"}), "",
+		"Missing header should give an empty string")
+}
+
+func TestWrongBoundary(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=\"wrong\"\r\n\r\n" +
+		"--right\r\nContent-Type: text/plain\r\n\r\nThe real body\r\n--right--\r\n"
+	_, err := ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	assert.NotNil(t, err, "Boundary that never appears should be an error")
+
+	p := &Parser{Lenient: true}
+	root, err := p.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Lenient parse should not have generated an error") {
+		t.FailNow()
+	}
+	if assert.NotNil(t, root.FirstChild(), "Body should be kept as a part") {
+		assert.Contains(t, string(root.FirstChild().Content()), "The real body",
+			"Body should not be lost")
+	}
+	if assert.Equal(t, len(p.Errors()), 1, "Missing boundary should be recorded") {
+		assert.Equal(t, p.Errors()[0].Name, "Missing Boundary", "Error should name the problem")
+	}
+
+	root, err = ParseMIME(bufio.NewReader(strings.NewReader(
+		"Content-Type: multipart/mixed; boundary=\"empty\"\r\n\r\n \r\n--empty--\r\nEpilogue\r\n")))
+	if assert.Nil(t, err, "Closing delimiter alone should not be an error") {
+		assert.Nil(t, root.FirstChild(), "Root should have no children")
+	}
+}
+
+func TestStrayBytes(t *testing.T) {
+	inner := "--inner\r\nContent-Type: text/plain\r\n\r\nText\r\n--inner--\r\n"
+	raw := "Content-Type: multipart/mixed; boundary=\"outer\"\r\n\r\n" +
+		"--outer\r\nContent-Type: multipart/alternative; boundary=\"inner\"\r\n\r\n" +
+		inner + "junk from the generator\r\n" +
+		"--outer\r\nContent-Type: text/plain\r\n\r\nNext\r\n--outer--\r\nEpilogue\r\n"
+	p := &Parser{Lenient: true}
+	root, err := p.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(root.FirstChild().NextSibling().Content()), "Next",
+		"Parts after the stray bytes should be parsed")
+	if assert.Equal(t, len(p.Errors()), 1, "Only the nested stray bytes should be recorded") {
+		assert.Equal(t, p.Errors()[0].Name, "Stray Bytes", "Error should name the problem")
+		assert.Contains(t, p.Errors()[0].Detail, fmt.Sprintf("from byte %v ", len(inner)),
+			"Error should give the offset within the multipart body")
+	}
+
+	_, err = new(Parser).ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	assert.Nil(t, err, "Stray bytes should not fail a strict parse")
+}
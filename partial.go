@@ -0,0 +1,128 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// ReassemblePartials joins the fragments of a message split into message/partial parts (RFC
+// 2046, section 5.2.2) and parses the result.  The fragments may be given in any order, but
+// must all carry the same id parameter, and every number from 1 to the total parameter must
+// be present exactly once.  As the RFC specifies, the header of the reassembled message takes
+// its Content-*, Subject, Message-ID, Encrypted and MIME-Version fields from the enclosed
+// header found in the first fragment, and all other fields from the header enclosing the first
+// fragment.
+func ReassemblePartials(parts []MIMEPart) (MIMEPart, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("No message/partial fragments")
+	}
+	var id string
+	total := 0
+	fragments := make(map[int]MIMEPart)
+	for _, p := range parts {
+		mediatype, params, err := parseMediaType(p.Header().Get("Content-Type"))
+		if err != nil {
+			return nil, err
+		}
+		if mediatype != "message/partial" {
+			return nil, fmt.Errorf("Not a message/partial fragment: %v", mediatype)
+		}
+		if id == "" {
+			id = params["id"]
+		}
+		if params["id"] == "" || params["id"] != id {
+			return nil, fmt.Errorf("Fragments with id %q and %q cannot be reassembled together",
+				id, params["id"])
+		}
+		number, err := strconv.Atoi(params["number"])
+		if err != nil || number < 1 {
+			return nil, fmt.Errorf("Invalid fragment number %q", params["number"])
+		}
+		if fragments[number] != nil {
+			return nil, fmt.Errorf("Duplicate fragment number %v", number)
+		}
+		fragments[number] = p
+		if params["total"] != "" {
+			total, err = strconv.Atoi(params["total"])
+			if err != nil || total < 1 {
+				return nil, fmt.Errorf("Invalid fragment total %q", params["total"])
+			}
+		}
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("Missing last fragment of %v, no total given", id)
+	}
+	buf := new(bytes.Buffer)
+	for number := 1; number <= total; number++ {
+		p := fragments[number]
+		if p == nil {
+			return nil, fmt.Errorf("Missing fragment %v of %v for %v", number, total, id)
+		}
+		buf.Write(p.Content())
+	}
+	if len(fragments) > total {
+		return nil, fmt.Errorf("Fragment number beyond total of %v for %v", total, id)
+	}
+
+	root, err := ParseMIME(bufio.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	header := make(textproto.MIMEHeader)
+	for key, values := range fragments[1].Header() {
+		if !isEnclosedField(key) {
+			header[key] = values
+		}
+	}
+	for key, values := range root.Header() {
+		if isEnclosedField(key) {
+			header[key] = values
+		}
+	}
+	root.(*memMIMEPart).header = header
+	return root, nil
+}
+
+// isEnclosedField returns true for the header fields of a reassembled message/partial that
+// come from the enclosed header rather than the enclosing one.
+func isEnclosedField(key string) bool {
+	switch key = textproto.CanonicalMIMEHeaderKey(key); key {
+	case "Subject", "Message-Id", "Encrypted", "Mime-Version":
+		return true
+	}
+	return strings.HasPrefix(key, "Content-")
+}
+
+// ReassembleSplitBase64 is a recovery tool for broken generators, such as some fax to email
+// gateways, that split a single base64 payload across consecutive parts of the same type.  It
+// concatenates the raw base64 text of the parts, in the order given, and decodes the combined
+// stream.  The raw content must have been kept by parsing with KeepRawContent; as a fragment
+// split in the middle of a base64 quantum does not decode by itself, set NoDecode as well, or
+// DecodeBodyOnly for fragments that are attachments.  An error is returned if the raw content
+// of a part was not kept, or if the combined stream is not valid base64.
+func ReassembleSplitBase64(parts []MIMEPart) ([]byte, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("No base64 fragments")
+	}
+	readers := make([]io.Reader, 0, len(parts))
+	for _, p := range parts {
+		raw := RawContent(p)
+		if raw == nil {
+			return nil, fmt.Errorf("Raw content of part %q was not kept, parse with "+
+				"KeepRawContent", PathIndex(p))
+		}
+		if encoding := TransferEncoding(p); encoding != "base64" {
+			return nil, fmt.Errorf("Part %q is not base64 encoded: %v", PathIndex(p), encoding)
+		}
+		readers = append(readers, bytes.NewReader(raw))
+	}
+	decoder := base64.NewDecoder(base64.StdEncoding, NewBase64Cleaner(io.MultiReader(readers...)))
+	return ioutil.ReadAll(decoder)
+}
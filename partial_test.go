@@ -0,0 +1,94 @@
+package enmime
+
+import (
+	"bufio"
+	"github.com/stretchrcom/testify/assert"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fragment parses a message/partial fragment of the message with the given id.
+func fragment(t *testing.T, id string, number, total int, body string) MIMEPart {
+	ctype := "message/partial; id=\"" + id + "\"; number=" + strconv.Itoa(number)
+	if total > 0 {
+		ctype += "; total=" + strconv.Itoa(total)
+	}
+	p, err := ParseMIME(bufio.NewReader(strings.NewReader(
+		"From: gateway@example.com\r\nSubject: Part " + strconv.Itoa(number) +
+			"\r\nContent-Type: " + ctype + "\r\n\r\n" + body)))
+	if err != nil {
+		t.Fatalf("Failed to parse fragment: %v", err)
+	}
+	return p
+}
+
+func TestReassemblePartials(t *testing.T) {
+	first := fragment(t, "abc@example.com", 1, 0,
+		"Subject: Large message\r\nContent-Type: text/plain\r\n\r\nFirst half, ")
+	last := fragment(t, "abc@example.com", 2, 2, "second half.")
+
+	p, err := ReassemblePartials([]MIMEPart{last, first})
+	if !assert.Nil(t, err, "Reassembly should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, p.ContentType(), "text/plain", "Expected the enclosed type")
+	assert.Equal(t, string(p.Content()), "First half, second half.", "Expected joined content")
+	assert.Equal(t, p.Header().Get("Subject"), "Large message", "Subject should be enclosed")
+	assert.Equal(t, p.Header().Get("From"), "gateway@example.com",
+		"Other fields should come from the enclosing header")
+}
+
+func TestReassemblePartialsErrors(t *testing.T) {
+	first := fragment(t, "abc@example.com", 1, 0, "Content-Type: text/plain\r\n\r\nOne")
+	third := fragment(t, "abc@example.com", 3, 3, "Three")
+
+	_, err := ReassemblePartials([]MIMEPart{first, third})
+	if assert.NotNil(t, err, "Missing fragment should generate an error") {
+		assert.Contains(t, err.Error(), "Missing fragment 2 of 3", "Error should name the gap")
+	}
+
+	_, err = ReassemblePartials([]MIMEPart{first})
+	assert.NotNil(t, err, "Unknown total should generate an error")
+
+	other := fragment(t, "xyz@example.com", 2, 2, "Two")
+	_, err = ReassemblePartials([]MIMEPart{first, other})
+	assert.NotNil(t, err, "Fragments of different messages should generate an error")
+
+	_, err = ReassemblePartials([]MIMEPart{first, first, third})
+	assert.NotNil(t, err, "Duplicate fragment should generate an error")
+
+	text := &memMIMEPart{contentType: "text/plain", header: textproto.MIMEHeader{}}
+	_, err = ReassemblePartials([]MIMEPart{text})
+	assert.NotNil(t, err, "Non-fragment should generate an error")
+}
+
+func TestReassembleSplitBase64(t *testing.T) {
+	// "Fax page one" is "RmF4IHBhZ2Ugb25l", split in the middle of a quantum
+	raw := "Content-Type: multipart/mixed; boundary=\"fax\"\r\n\r\n" +
+		"--fax\r\nContent-Type: image/tiff\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		"RmF4IH\r\n" +
+		"--fax\r\nContent-Type: image/tiff\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		"BhZ2Ugb25l\r\n" +
+		"--fax--\r\n"
+	p := &Parser{KeepRawContent: true, NoDecode: true}
+	root, err := p.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	parts := []MIMEPart{root.FirstChild(), root.FirstChild().NextSibling()}
+	content, err := ReassembleSplitBase64(parts)
+	if assert.Nil(t, err, "Fragments should reassemble") {
+		assert.Equal(t, string(content), "Fax page one", "Payload should be decoded whole")
+	}
+
+	raw = strings.Replace(raw, "RmF4IH\r\n", "RmF4\r\n", 1)
+	raw = strings.Replace(raw, "BhZ2Ugb25l", "IHBhZ2Ugb25l", 1)
+	root, err = new(Parser).ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	_, err = ReassembleSplitBase64([]MIMEPart{root.FirstChild()})
+	assert.NotNil(t, err, "Missing raw content should be an error")
+}
@@ -0,0 +1,51 @@
+package enmime
+
+import (
+	"strings"
+)
+
+// Priority levels returned by MIMEBody.Priority, 1 being the most urgent.
+const (
+	PriorityHighest = 1
+	PriorityHigh    = 2
+	PriorityNormal  = 3
+	PriorityLow     = 4
+	PriorityLowest  = 5
+)
+
+// Priority returns the priority of the message on a scale from PriorityHighest (1) to
+// PriorityLowest (5), for flagging urgent messages.  The headers used by different clients are
+// consulted in this order, the first one with a recognized value deciding:
+//
+//   - X-Priority, whose leading digit 1 to 5 is used as is, e.g. "1 (Highest)"
+//   - Priority (RFC 2156): "urgent" is 1, "normal" is 3 and "non-urgent" is 5
+//   - Importance: "high" is 1, "normal" is 3 and "low" is 5
+//   - X-MSMail-Priority: "high" is 1, "normal" is 3 and "low" is 5
+//
+// Values are compared case insensitively.  PriorityNormal is returned if no header gives a
+// recognized priority.
+func (m *MIMEBody) Priority() int {
+	value := strings.TrimSpace(m.header.Get("X-Priority"))
+	if value != "" && value[0] >= '1' && value[0] <= '5' {
+		return int(value[0] - '0')
+	}
+	switch strings.ToLower(strings.TrimSpace(m.header.Get("Priority"))) {
+	case "urgent":
+		return PriorityHighest
+	case "normal":
+		return PriorityNormal
+	case "non-urgent":
+		return PriorityLowest
+	}
+	for _, key := range []string{"Importance", "X-MSMail-Priority"} {
+		switch strings.ToLower(strings.TrimSpace(m.header.Get(key))) {
+		case "high":
+			return PriorityHighest
+		case "normal":
+			return PriorityNormal
+		case "low":
+			return PriorityLowest
+		}
+	}
+	return PriorityNormal
+}
@@ -0,0 +1,28 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"net/mail"
+	"testing"
+)
+
+func TestPriority(t *testing.T) {
+	priority := func(header mail.Header) int {
+		return (&MIMEBody{header: header}).Priority()
+	}
+	assert.Equal(t, priority(mail.Header{}), PriorityNormal, "No header should be normal")
+	assert.Equal(t, priority(mail.Header{"X-Priority": {"1 (Highest)"}}), PriorityHighest,
+		"X-Priority digit should be used")
+	assert.Equal(t, priority(mail.Header{"X-Priority": {"2"}}), PriorityHigh,
+		"X-Priority digit should be used")
+	assert.Equal(t, priority(mail.Header{"Priority": {"Non-Urgent"}}), PriorityLowest,
+		"Priority should be recognized")
+	assert.Equal(t, priority(mail.Header{"Importance": {"HIGH"}}), PriorityHighest,
+		"Importance should be case insensitive")
+	assert.Equal(t, priority(mail.Header{"X-Msmail-Priority": {"Low"}}), PriorityLowest,
+		"X-MSMail-Priority should be recognized")
+	assert.Equal(t, priority(mail.Header{"X-Priority": {"5"}, "Importance": {"high"}}),
+		PriorityLowest, "X-Priority should take precedence")
+	assert.Equal(t, priority(mail.Header{"X-Priority": {"urgent"}, "Importance": {"low"}}),
+		PriorityLowest, "Unrecognized values should fall through")
+}
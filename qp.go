@@ -0,0 +1,84 @@
+package enmime
+
+import (
+	"github.com/sloonz/go-qprintable"
+	"io"
+	"mime/quotedprintable"
+)
+
+// QPDecoder is implemented by quoted-printable decoders, allowing a Parser to use a decoder
+// other than the default.
+type QPDecoder interface {
+	// NewDecoder returns a reader that decodes the quoted-printable data read from r.
+	NewDecoder(r io.Reader) io.Reader
+}
+
+// QPDecoderFunc adapts an ordinary function to the QPDecoder interface.
+type QPDecoderFunc func(r io.Reader) io.Reader
+
+// NewDecoder calls f(r).
+func (f QPDecoderFunc) NewDecoder(r io.Reader) io.Reader {
+	return f(r)
+}
+
+var (
+	// QPrintableDecoder decodes using github.com/sloonz/go-qprintable, translating line
+	// breaks to CRLF.  It was the default in earlier releases.
+	QPrintableDecoder QPDecoder = QPDecoderFunc(func(r io.Reader) io.Reader {
+		return qprintable.NewDecoder(qprintable.WindowsTextEncoding, r)
+	})
+
+	// StdQPDecoder decodes using the standard library's mime/quotedprintable package, which
+	// tolerates lowercase hex digits and stray equals signs.  It is the default.
+	StdQPDecoder QPDecoder = QPDecoderFunc(func(r io.Reader) io.Reader {
+		return quotedprintable.NewReader(r)
+	})
+)
+
+// escapeLiteralEquals replaces each equals sign in quoted-printable data that starts neither an
+// escaped byte such as "=3D" nor a soft line break with "=3D", so that a literal "=" left by a
+// broken encoder, as in "1 + 1 =2", decodes to itself with any QPDecoder.  It returns the data
+// along with the number of equals signs escaped.
+func escapeLiteralEquals(data []byte) ([]byte, int) {
+	var out []byte
+	count := 0
+	last := 0
+	for i := 0; i < len(data); i++ {
+		if data[i] != '=' || isQPEscape(data[i+1:]) {
+			continue
+		}
+		if out == nil {
+			out = make([]byte, 0, len(data)+16)
+		}
+		out = append(append(out, data[last:i]...), "=3D"...)
+		last = i + 1
+		count++
+	}
+	if out == nil {
+		return data, 0
+	}
+	return append(out, data[last:]...), count
+}
+
+// isQPEscape returns true if rest, the data following an equals sign, makes it an escaped byte
+// or a soft line break, which may be preceded by trailing whitespace or end the data.
+func isQPEscape(rest []byte) bool {
+	if len(rest) >= 2 && isHexDigit(rest[0]) && isHexDigit(rest[1]) {
+		return true
+	}
+	for _, b := range rest {
+		switch b {
+		case ' ', '\t':
+			continue
+		case '\r', '\n':
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// isHexDigit returns true for the hex digits, in either case, used by quoted-printable escapes.
+func isHexDigit(b byte) bool {
+	return '0' <= b && b <= '9' || 'A' <= b && b <= 'F' || 'a' <= b && b <= 'f'
+}
@@ -0,0 +1,119 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/stretchrcom/testify/assert"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCustomQPDecoder(t *testing.T) {
+	called := false
+	p := &Parser{QPDecoder: QPDecoderFunc(func(r io.Reader) io.Reader {
+		called = true
+		data, _ := ioutil.ReadAll(r)
+		return bytes.NewReader(bytes.ToUpper(data))
+	})}
+	root, err := p.ParseMIME(openPart("quoted-printable.raw"))
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.True(t, called, "Custom decoder should have been used")
+	assert.Equal(t, string(root.Content()), "START=3D=41=42=\n=43=3DFINISH=\n",
+		"Content should come from the custom decoder")
+}
+
+func TestCustomQPDecoderMultipart(t *testing.T) {
+	p := &Parser{QPDecoder: QPDecoderFunc(func(r io.Reader) io.Reader {
+		data, _ := ioutil.ReadAll(r)
+		return bytes.NewReader(bytes.ToUpper(data))
+	})}
+	msg, err := p.ParseMIMEBody(readMessage("quoted-printable-mime.raw"))
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Contains(t, msg.Text, "LOREM IPSUM", "Parts should use the custom decoder")
+}
+
+func TestStdQPDecoder(t *testing.T) {
+	p := &Parser{QPDecoder: StdQPDecoder}
+	root, err := p.ParseMIME(openPart("quoted-printable.raw"))
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(root.Content()), "Start=ABC=Finish", "Content should be decoded")
+
+	data, err := ioutil.ReadAll(StdQPDecoder.NewDecoder(strings.NewReader("caf=C3=A9")))
+	assert.Nil(t, err, "Decoding should not have generated an error")
+	assert.Equal(t, string(data), "café", "Content should be decoded")
+}
+
+func TestDefaultQPDecoder(t *testing.T) {
+	raw := "Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\ncaf=c3=a9"
+	root, err := ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(root.Content()), "café", "Lowercase hex should be decoded by default")
+}
+
+func TestQPDecodersTrickyInputs(t *testing.T) {
+	decode := func(d QPDecoder, input string) string {
+		data, err := ioutil.ReadAll(d.NewDecoder(strings.NewReader(input)))
+		assert.Nil(t, err, "Decoding %q should not have generated an error", input)
+		return string(data)
+	}
+
+	// Well formed input decodes the same either way
+	wellFormed := "Start=3D=41=42=\r\n=43=3DFinish\r\nLine two"
+	assert.Equal(t, decode(StdQPDecoder, wellFormed), "Start=ABC=Finish\r\nLine two",
+		"Well formed input should be decoded")
+	assert.Equal(t, decode(StdQPDecoder, wellFormed), decode(QPrintableDecoder, wellFormed),
+		"Decoders should agree on well formed input")
+
+	// Inputs the standard decoder tolerates
+	assert.Equal(t, decode(StdQPDecoder, "caf=c3=a9"), "café", "Lowercase hex should be decoded")
+	assert.Equal(t, decode(StdQPDecoder, "a = b"), "a = b", "Bare equals should be kept")
+	assert.Equal(t, decode(StdQPDecoder, "=zz ok"), "=zz ok", "Invalid escape should be kept")
+	assert.Equal(t, decode(StdQPDecoder, "price="), "price", "Trailing soft break should be dropped")
+	assert.Equal(t, decode(StdQPDecoder, "tab\t\r\nnext"), "tab\r\nnext",
+		"Trailing whitespace should be dropped")
+}
+
+func TestEscapeLiteralEquals(t *testing.T) {
+	data, count := escapeLiteralEquals([]byte("1 + 1 =2\r\na=3D=\r\nb =  \r\nc=e9 x=yz ="))
+	assert.Equal(t, string(data), "1 + 1 =3D2\r\na=3D=\r\nb =  \r\nc=e9 x=3Dyz =",
+		"Only literal equals signs should be escaped")
+	assert.Equal(t, count, 2, "Expected two literal equals signs")
+
+	data, count = escapeLiteralEquals([]byte("Start=3DFinish"))
+	assert.Equal(t, string(data), "Start=3DFinish", "Valid data should be unchanged")
+	assert.Equal(t, count, 0, "Valid data has no literal equals signs")
+}
+
+func TestLenientLiteralEquals(t *testing.T) {
+	raw := "Content-Type: text/plain\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"1 + 1 =2, caf=C3=A9\r\n"
+	for _, decoder := range []QPDecoder{StdQPDecoder, QPrintableDecoder} {
+		p := &Parser{Lenient: true, QPDecoder: decoder}
+		root, err := p.ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+		if !assert.Nil(t, err, "Lenient parsing should not have generated an error") {
+			t.FailNow()
+		}
+		assert.Equal(t, strings.TrimSpace(string(root.Content())), "1 + 1 =2, café",
+			"Literal equals sign should be kept")
+		if assert.Equal(t, len(p.errors), 1, "Literal equals sign should be recorded") {
+			assert.Equal(t, p.errors[0].Name, "Literal Equals", "Error should name the problem")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package enmime
+
+import (
+	"strings"
+)
+
+// Renderable returns the parts a mail client displays directly: the parts providing the Text
+// and Html of the message, and the images to show alongside them.  An image is renderable if
+// the HTML body references its Content-ID with a cid: URL, or if its InferredDisposition is
+// inline.  Missing parts are nil; all results are nil for a message that is not
+// multipart.
+func (m *MIMEBody) Renderable() (text, html MIMEPart, inlineImages []MIMEPart) {
+	if m.Root == nil {
+		return nil, nil, nil
+	}
+	inlineImages = BreadthMatchAll(m.Root, m.isRenderableImage)
+	return textBodyPart(m.Root), htmlBodyPart(m.Root), inlineImages
+}
+
+// Downloadable returns every part that is not Renderable and should be offered as a download
+// instead: attachments, inline parts other than images, and any other leaf part that is
+// neither the text nor the HTML body.  Multipart containers and the resource fork of a
+// multipart/appledouble are never included.
+func (m *MIMEBody) Downloadable() []MIMEPart {
+	if m.Root == nil {
+		return nil
+	}
+	text, html, _ := m.Renderable()
+	return BreadthMatchAll(m.Root, func(p MIMEPart) bool {
+		return p.FirstChild() == nil && !strings.HasPrefix(p.ContentType(), "multipart/") &&
+			!isAppleFile(p) && p != text && p != html && !m.isRenderableImage(p)
+	})
+}
+
+// isRenderableImage is the MIMEPartMatcher for images displayed with the message body.
+func (m *MIMEBody) isRenderableImage(p MIMEPart) bool {
+	if !strings.HasPrefix(p.ContentType(), "image/") {
+		return false
+	}
+	if id := contentID(p); id != "" {
+		for _, ref := range cidRef.FindAllStringSubmatch(m.Html, -1) {
+			if ref[1] == id {
+				return true
+			}
+		}
+	}
+	return InferredDisposition(p) == "inline"
+}
+
+// InferredDisposition returns the disposition of the part, "inline" or "attachment", inferring
+// it from the content type when the part has no Content-Disposition header:
+//
+//   - multipart containers have no disposition, "" is returned
+//   - text parts are "inline" bodies, unless they have a file name
+//   - images in a multipart/related are "inline", referenced by the HTML body
+//   - anything else, including other images, is an "attachment"
+//
+// A declared disposition is always returned as is.
+func InferredDisposition(p MIMEPart) string {
+	if p.Disposition() != "" {
+		return p.Disposition()
+	}
+	ctype := p.ContentType()
+	switch {
+	case strings.HasPrefix(ctype, "multipart/"):
+		return ""
+	case strings.HasPrefix(ctype, "text/") && p.FileName() == "":
+		return "inline"
+	case strings.HasPrefix(ctype, "image/"):
+		if parent := p.Parent(); parent != nil && parent.ContentType() == "multipart/related" {
+			return "inline"
+		}
+	}
+	return "attachment"
+}
+
+// IsAttachment returns true if the part is meant to be handled as an attachment, resolving
+// headers that disagree: the Content-Disposition header always decides, so a part with a name
+// parameter in its Content-Type but an inline disposition is not an attachment.  Without a
+// Content-Disposition the disposition is inferred, see InferredDisposition.  Whether a part
+// can be saved to a file is a separate question answered by IsSaveable.
+func IsAttachment(p MIMEPart) bool {
+	return InferredDisposition(p) == "attachment"
+}
+
+// IsInline returns true if the part is meant to be displayed with the message body, with the
+// same precedence as IsAttachment.
+func IsInline(p MIMEPart) bool {
+	return InferredDisposition(p) == "inline"
+}
+
+// IsSaveable returns true if the part can be offered for saving to a file: it is an
+// attachment, or it has a file name from either the Content-Disposition or the Content-Type
+// header, even if it is displayed inline.
+func IsSaveable(p MIMEPart) bool {
+	return p.FileName() != "" || IsAttachment(p)
+}
+
+// DefaultTextTypes lists the content types besides text/* that IsText treats as text:
+// application/json, application/xml and message/rfc822-headers.
+var DefaultTextTypes = []string{"application/json", "application/xml", "message/rfc822-headers"}
+
+// IsText returns true if the content of the part can be shown as text: its content type is
+// text/* or one of the DefaultTextTypes.  Use the IsText method of a Parser to configure the
+// types.
+func IsText(p MIMEPart) bool {
+	return isTextType(p.ContentType(), DefaultTextTypes)
+}
+
+// IsText returns true if the content of the part can be shown as text: its content type is
+// text/* or one of the TextTypes of the Parser, DefaultTextTypes if nil.
+func (p *Parser) IsText(part MIMEPart) bool {
+	types := p.TextTypes
+	if types == nil {
+		types = DefaultTextTypes
+	}
+	return isTextType(part.ContentType(), types)
+}
+
+// isTextType returns true if ctype is text/* or matches one of types.
+func isTextType(ctype string, types []string) bool {
+	return strings.HasPrefix(ctype, "text/") || matchesType(ctype, types)
+}
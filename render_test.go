@@ -0,0 +1,128 @@
+package enmime
+
+import (
+	"bufio"
+	"github.com/stretchrcom/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestRenderable(t *testing.T) {
+	msg := readMessage("renderable.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	text, html, images := mime.Renderable()
+	if assert.NotNil(t, text, "Should have a text part") {
+		assert.Equal(t, string(text.Content()), "A text section", "Text part should be the body")
+	}
+	if assert.NotNil(t, html, "Should have an HTML part") {
+		assert.Equal(t, html.ContentType(), "text/html", "HTML part should be the body")
+	}
+	if assert.Equal(t, len(images), 1, "Should have one inline image") {
+		assert.Equal(t, images[0].FileName(), "logo.png",
+			"Image referenced by cid should be renderable despite attachment disposition")
+	}
+}
+
+func TestDownloadable(t *testing.T) {
+	msg := readMessage("renderable.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	parts := mime.Downloadable()
+	if assert.Equal(t, len(parts), 2, "Should have two downloads") {
+		assert.Equal(t, parts[0].FileName(), "photo.jpg", "Unreferenced image should download")
+		assert.Equal(t, parts[1].FileName(), "doc.pdf", "Document should download")
+	}
+}
+
+func TestRenderableInline(t *testing.T) {
+	msg := readMessage("html-mime-inline.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	_, _, images := mime.Renderable()
+	assert.Equal(t, len(images), 1, "Should have one inline image")
+	assert.Equal(t, len(mime.Downloadable()), 0, "Should have no downloads")
+}
+
+func TestInferredDisposition(t *testing.T) {
+	related := &memMIMEPart{contentType: "multipart/related"}
+	mixed := &memMIMEPart{contentType: "multipart/mixed"}
+
+	assert.Equal(t, InferredDisposition(mixed), "", "Multipart should have no disposition")
+	assert.Equal(t, InferredDisposition(&memMIMEPart{contentType: "text/plain", parent: mixed}),
+		"inline", "Text without a file name should be inline")
+	assert.Equal(t, InferredDisposition(&memMIMEPart{contentType: "text/csv", parent: mixed,
+		fileName: "data.csv"}), "attachment", "Text with a file name should be an attachment")
+	assert.Equal(t, InferredDisposition(&memMIMEPart{contentType: "image/png", parent: related}),
+		"inline", "Image in related should be inline")
+	assert.Equal(t, InferredDisposition(&memMIMEPart{contentType: "image/png", parent: mixed}),
+		"attachment", "Image in mixed should be an attachment")
+	assert.Equal(t, InferredDisposition(&memMIMEPart{contentType: "application/pdf",
+		parent: related}), "attachment", "Application should be an attachment")
+	assert.Equal(t, InferredDisposition(&memMIMEPart{contentType: "application/pdf",
+		disposition: "inline"}), "inline", "Declared disposition should be kept")
+}
+
+func TestConflictingDisposition(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=\"Enmime-Conflict\"\r\n" +
+		"\r\n" +
+		"--Enmime-Conflict\r\n" +
+		"Content-Type: image/png; name=\"logo.png\"\r\n" +
+		"Content-Disposition: inline\r\n" +
+		"\r\n" +
+		"PNG\r\n" +
+		"--Enmime-Conflict\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Disposition: attachment\r\n" +
+		"\r\n" +
+		"Notes\r\n" +
+		"--Enmime-Conflict\r\n" +
+		"Content-Type: image/png; name=\"photo.png\"\r\n" +
+		"\r\n" +
+		"PNG\r\n" +
+		"--Enmime-Conflict--\r\n"
+	root, err := ParseMIME(bufio.NewReader(strings.NewReader(raw)))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+
+	named := root.FirstChild()
+	assert.True(t, IsInline(named), "Inline disposition should win over a name parameter")
+	assert.False(t, IsAttachment(named), "Inline part should not be an attachment")
+	assert.True(t, IsSaveable(named), "Named inline part should be saveable")
+
+	unnamed := named.NextSibling()
+	assert.True(t, IsAttachment(unnamed), "Attachment disposition should win over text type")
+	assert.False(t, IsInline(unnamed), "Attachment should not be inline")
+	assert.True(t, IsSaveable(unnamed), "Attachment without a name should be saveable")
+
+	undeclared := unnamed.NextSibling()
+	assert.True(t, IsAttachment(undeclared), "Image in mixed should be inferred an attachment")
+	assert.True(t, IsSaveable(undeclared), "Inferred attachment should be saveable")
+
+	body := &memMIMEPart{contentType: "text/plain", parent: root}
+	assert.True(t, IsInline(body), "Text without disposition should be inline")
+	assert.False(t, IsSaveable(body), "Unnamed inline text should not be saveable")
+}
+
+func TestIsText(t *testing.T) {
+	data := &memMIMEPart{contentType: "application/json"}
+	assert.True(t, IsText(&memMIMEPart{contentType: "text/calendar"}), "text/* should be text")
+	assert.True(t, IsText(data), "JSON should be text by default")
+	assert.False(t, IsText(&memMIMEPart{contentType: "image/png"}), "Image should not be text")
+
+	p := &Parser{TextTypes: []string{"application/*"}}
+	assert.True(t, p.IsText(&memMIMEPart{contentType: "application/pdf"}), "Wildcard should match")
+	assert.False(t, p.IsText(&memMIMEPart{contentType: "message/rfc822-headers"}),
+		"TextTypes should replace the default types")
+	assert.True(t, new(Parser).IsText(data), "Parser should use the default types")
+}
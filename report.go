@@ -0,0 +1,78 @@
+package enmime
+
+import (
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// MDN holds the fields of a message/disposition-notification part (RFC 3798), the machine
+// readable portion of a read receipt.
+type MDN struct {
+	ReportingUA       string               // Reporting-UA field
+	OriginalRecipient string               // Original-Recipient field
+	FinalRecipient    string               // Final-Recipient field
+	OriginalMessageID string               // Original-Message-ID field
+	Disposition       string               // Disposition field, e.g. "manual-action/...; displayed"
+	Fields            textproto.MIMEHeader // All fields of the notification
+}
+
+// DispositionNotificationTo returns the addresses a read receipt was requested to be sent to
+// via the Disposition-Notification-To header, or nil if none was requested.
+func (m *MIMEBody) DispositionNotificationTo() []*mail.Address {
+	addrs, err := m.header.AddressList("Disposition-Notification-To")
+	if err != nil {
+		return nil
+	}
+	return addrs
+}
+
+// ReturnPath returns the envelope sender recorded in the Return-Path header by the delivering
+// server, without its angle brackets.  This is the address bounces are sent to, which may
+// differ from the From header.  It returns "" if there is no Return-Path header, and also for
+// the null sender "<>" used by bounces themselves; use IsNullSender to tell the two apart.
+func (m *MIMEBody) ReturnPath() string {
+	value := strings.TrimSpace(m.header.Get("Return-Path"))
+	if strings.HasPrefix(value, "<") {
+		if end := strings.Index(value, ">"); end > 0 {
+			return strings.TrimSpace(value[1:end])
+		}
+	}
+	if addr, err := mail.ParseAddress(value); err == nil {
+		return addr.Address
+	}
+	return value
+}
+
+// IsNullSender returns true if the message has the null Return-Path "<>", which marks
+// bounces and other automatic replies that must not themselves be bounced.
+func (m *MIMEBody) IsNullSender() bool {
+	value := m.header.Get("Return-Path")
+	return value != "" && strings.Replace(value, " ", "", -1) == "<>"
+}
+
+// MDN returns the parsed message/disposition-notification part of a read receipt.  ok is
+// false if the message does not contain one.
+func (m *MIMEBody) MDN() (mdn *MDN, ok bool) {
+	if m.Root == nil {
+		return nil, false
+	}
+	match := BreadthMatchFirst(m.Root, func(p MIMEPart) bool {
+		return p.ContentType() == "message/disposition-notification"
+	})
+	if match == nil {
+		return nil, false
+	}
+	fields, err := ParseHeaderBlock(match.Content())
+	if err != nil {
+		return nil, false
+	}
+	return &MDN{
+		ReportingUA:       fields.Get("Reporting-UA"),
+		OriginalRecipient: fields.Get("Original-Recipient"),
+		FinalRecipient:    fields.Get("Final-Recipient"),
+		OriginalMessageID: fields.Get("Original-Message-ID"),
+		Disposition:       fields.Get("Disposition"),
+		Fields:            fields,
+	}, true
+}
@@ -0,0 +1,69 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"net/mail"
+	"testing"
+)
+
+func TestMDN(t *testing.T) {
+	msg := readMessage("mdn.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	assert.Equal(t, mime.Text, "Your message was displayed.", "Should have text section")
+	mdn, ok := mime.MDN()
+	if !assert.True(t, ok, "Should have found an MDN") {
+		t.FailNow()
+	}
+	assert.Equal(t, mdn.OriginalMessageID, "<07B7061D-2676-487E-942E-C341CE4D13DC@makita.skynet>",
+		"Should have original message ID")
+	assert.Equal(t, mdn.Disposition, "manual-action/MDN-sent-manually; displayed",
+		"Should have disposition")
+	assert.Equal(t, mdn.FinalRecipient, "rfc822;greg@inbucket", "Should have final recipient")
+	assert.Equal(t, mdn.Fields.Get("Reporting-UA"), "inbucket; enmime", "Should keep all fields")
+}
+
+func TestMDNMissing(t *testing.T) {
+	msg := readMessage("attachment.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	_, ok := mime.MDN()
+	assert.False(t, ok, "Should not have found an MDN")
+	assert.Nil(t, mime.DispositionNotificationTo(), "Should not have requested a receipt")
+}
+
+func TestDispositionNotificationTo(t *testing.T) {
+	msg := readMessage("mdn-request.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	addrs := mime.DispositionNotificationTo()
+	if assert.Equal(t, len(addrs), 1, "Should have requested a receipt") {
+		assert.Equal(t, addrs[0].Address, "james@makita.skynet", "Should have receipt address")
+	}
+}
+
+func TestReturnPath(t *testing.T) {
+	mime := &MIMEBody{header: mail.Header{"Return-Path": {"<bounce+123@lists.example.com>"}}}
+	assert.Equal(t, mime.ReturnPath(), "bounce+123@lists.example.com", "Brackets should be removed")
+	assert.False(t, mime.IsNullSender(), "Should not be a null sender")
+
+	mime = &MIMEBody{header: mail.Header{"Return-Path": {"bounce@example.com"}}}
+	assert.Equal(t, mime.ReturnPath(), "bounce@example.com", "Bare address should be returned")
+
+	mime = &MIMEBody{header: mail.Header{"Return-Path": {"< >"}}}
+	assert.Equal(t, mime.ReturnPath(), "", "Null sender should have an empty path")
+	assert.True(t, mime.IsNullSender(), "Should be a null sender")
+
+	mime = &MIMEBody{header: mail.Header{}}
+	assert.Equal(t, mime.ReturnPath(), "", "Missing header should have an empty path")
+	assert.False(t, mime.IsNullSender(), "Missing header should not be a null sender")
+}
@@ -0,0 +1,29 @@
+package enmime
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net/mail"
+	"net/textproto"
+)
+
+// ReadMIMEBodySMTP reads a message from an SMTP DATA stream and parses its body with
+// ParseMIMEBody.  Dot-stuffing is removed and reading stops at the terminating "." line, so
+// an SMTP server can feed the raw DATA stream straight into enmime.  Line endings are
+// converted from CRLF to LF.  The DATA stream is always read up to the terminating line, even
+// when parsing stops early or fails, so a *bufio.Reader passed in is left at the next command.
+func ReadMIMEBodySMTP(r io.Reader) (*MIMEBody, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	data := textproto.NewReader(br).DotReader()
+	// The parser stops at the closing boundary, leaving any epilogue unread
+	defer io.Copy(ioutil.Discard, data)
+	msg, err := mail.ReadMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMIMEBody(msg)
+}
@@ -0,0 +1,59 @@
+package enmime
+
+import (
+	"bufio"
+	"github.com/stretchrcom/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReadMIMEBodySMTP(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("Subject: Dots\r\n\r\n" +
+		"..leading dot\r\n" +
+		"middle\r\n" +
+		".\r\n" +
+		"QUIT\r\n"))
+	mime, err := ReadMIMEBodySMTP(r)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Text, ".leading dot\nmiddle\n", "Dot-stuffing should be removed")
+	rest, _ := ioutil.ReadAll(r)
+	assert.Equal(t, string(rest), "QUIT\r\n", "Reading should stop at the terminating dot")
+}
+
+func TestReadMIMEBodySMTPMultipart(t *testing.T) {
+	data := strings.Replace(string(readRaw("attachment.raw")), "\n", "\r\n", -1) + ".\r\n"
+	mime, err := ReadMIMEBodySMTP(strings.NewReader(data))
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Text, "A text section", "Should have text section")
+	assert.Equal(t, len(mime.Attachments), 1, "Should have a single attachment")
+}
+
+func TestReadMIMEBodySMTPEpilogue(t *testing.T) {
+	epilogue := strings.Repeat("epilogue line of text\r\n", 400)
+	data := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nBody\r\n--b--\r\n" + epilogue + ".\r\n" +
+		"QUIT\r\n"
+	r := bufio.NewReader(strings.NewReader(data))
+	mime, err := ReadMIMEBodySMTP(r)
+
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, mime.Text, "Body", "Should have text section")
+	rest, _ := ioutil.ReadAll(r)
+	assert.Equal(t, string(rest), "QUIT\r\n", "The epilogue should be read to the terminating dot")
+
+	// A message that fails to parse is read to the end as well
+	r = bufio.NewReader(strings.NewReader("Not a header\r\n" + epilogue + ".\r\nQUIT\r\n"))
+	_, err = ReadMIMEBodySMTP(r)
+	assert.NotNil(t, err, "Parsing should have generated an error")
+	rest, _ = ioutil.ReadAll(r)
+	assert.Equal(t, string(rest), "QUIT\r\n", "A failed message should be read to the end")
+}
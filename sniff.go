@@ -0,0 +1,33 @@
+package enmime
+
+import (
+	"mime"
+	"net/http"
+)
+
+// genericTypes are declared content types that say nothing about the actual content.
+var genericTypes = map[string]bool{
+	"":                           true,
+	"application/octet-stream":   true,
+	"application/binary":         true,
+	"application/unknown":        true,
+	"application/force-download": true,
+	"application/x-download":     true,
+}
+
+// EffectiveContentType returns the part's declared content type, unless it is a generic type
+// such as application/octet-stream and sniffing the content identifies something more
+// specific, e.g. a JPEG image sent by a lazy client.  It is meant for classification and
+// choosing file extensions; the declared type remains available from ContentType.
+func EffectiveContentType(p MIMEPart) string {
+	declared := p.ContentType()
+	if !genericTypes[declared] || len(p.Content()) == 0 {
+		return declared
+	}
+	sniffed, _, err := mime.ParseMediaType(http.DetectContentType(p.Content()))
+	if err != nil || sniffed == "application/octet-stream" || sniffed == "text/plain" {
+		// Nothing better than what was declared
+		return declared
+	}
+	return sniffed
+}
@@ -0,0 +1,21 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"testing"
+)
+
+func TestEffectiveContentType(t *testing.T) {
+	png := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0}
+
+	p := &memMIMEPart{contentType: "application/octet-stream", content: png}
+	assert.Equal(t, EffectiveContentType(p), "image/png", "Generic type should be sniffed")
+	assert.Equal(t, p.ContentType(), "application/octet-stream", "Declared type should be kept")
+
+	p = &memMIMEPart{contentType: "image/gif", content: png}
+	assert.Equal(t, EffectiveContentType(p), "image/gif", "Specific type should be trusted")
+
+	p = &memMIMEPart{contentType: "application/octet-stream", content: []byte("plain words")}
+	assert.Equal(t, EffectiveContentType(p), "application/octet-stream",
+		"Unrecognized content should keep the declared type")
+}
@@ -0,0 +1,80 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// maxSignalParts is the number of parts above which a message has the "excessive-parts" signal.
+const maxSignalParts = 50
+
+// StructuralSpamSignals returns flags for structural traits common in spam, to feed a scoring
+// system.  They only describe the shape of the message, not what it says, and each is cheap to
+// compute from the parsed message:
+//
+//   - "empty-text-body": neither the Text nor the Html has any non-whitespace content
+//   - "single-image-only": the only leaf part with content is a single image
+//   - "mismatched-charset": the content of a text part did not match its declared charset,
+//     as recorded in the Errors when the charset was unsupported, failed to convert or was
+//     us-ascii with 8-bit bytes
+//   - "excessive-parts": the message has more than 50 parts
+//   - "hidden-preamble-text": text other than the usual notice for readers without MIME
+//     support precedes the first boundary, where mail clients do not display it; this is only
+//     detected when the message was parsed with Parser.KeepRawBody set
+//
+// Flags are returned in the order above, or nil if there are none.
+func (m *MIMEBody) StructuralSpamSignals() []string {
+	var signals []string
+	if strings.TrimSpace(m.Text) == "" && strings.TrimSpace(m.Html) == "" {
+		signals = append(signals, "empty-text-body")
+	}
+	if m.Root != nil {
+		leaves := BreadthMatchAll(m.Root, func(p MIMEPart) bool {
+			return p.FirstChild() == nil && !strings.HasPrefix(p.ContentType(), "multipart/") &&
+				len(bytes.TrimSpace(p.Content())) > 0
+		})
+		if len(leaves) == 1 && strings.HasPrefix(leaves[0].ContentType(), "image/") {
+			signals = append(signals, "single-image-only")
+		}
+	}
+	for _, e := range m.Errors {
+		if e.Name == "Unsupported Charset" || e.Name == "Charset Conversion" ||
+			e.Name == "8-bit ASCII" {
+			signals = append(signals, "mismatched-charset")
+			break
+		}
+	}
+	if m.Root != nil && Complexity(m.Root).Parts > maxSignalParts {
+		signals = append(signals, "excessive-parts")
+	}
+	if m.hasHiddenPreamble() {
+		signals = append(signals, "hidden-preamble-text")
+	}
+	return signals
+}
+
+// hasHiddenPreamble returns true if the preamble of a multipart message kept by KeepRawBody
+// has lines other than blank lines and notices mentioning MIME, such as "This is a multi-part
+// message in MIME format."
+func (m *MIMEBody) hasHiddenPreamble() bool {
+	if m.Root == nil || m.rawBody == nil {
+		return false
+	}
+	_, params, err := parseMediaType(m.Root.Header().Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return false
+	}
+	preamble, _, err := new(Parser).readPreamble(bytes.NewReader(m.rawBody), params["boundary"])
+	if err != nil {
+		return false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(preamble))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.Contains(strings.ToLower(line), "mime") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package enmime
+
+import (
+	"bufio"
+	"github.com/stretchrcom/testify/assert"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestStructuralSpamSignals(t *testing.T) {
+	mime, err := ParseMIMEBody(readMessage("html-mime-inline.raw"))
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Nil(t, mime.StructuralSpamSignals(), "Ordinary message should have no signals")
+
+	raw := "Content-Type: multipart/mixed; boundary=\"Enmime-Spam\"\r\n" +
+		"\r\n" +
+		"This is a multi-part message in MIME format.\r\n" +
+		"cheap watches cheap watches\r\n" +
+		"--Enmime-Spam\r\n" +
+		"Content-Type: text/plain; charset=us-ascii\r\n" +
+		"\r\n" +
+		"\r\n" +
+		"--Enmime-Spam\r\n" +
+		"Content-Type: image/gif\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"R0lGODlh\r\n" +
+		"--Enmime-Spam--\r\n"
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	mime, err = (&Parser{KeepRawBody: true}).ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, mime.StructuralSpamSignals(),
+		[]string{"empty-text-body", "single-image-only", "hidden-preamble-text"},
+		"Expected the image spam signals")
+}
+
+func TestStructuralSpamSignalsCharset(t *testing.T) {
+	raw := "Content-Type: multipart/mixed; boundary=\"Enmime-Spam\"\r\n" +
+		"\r\n" +
+		"This is a multi-part message in MIME format.\r\n" +
+		"--Enmime-Spam\r\n" +
+		"Content-Type: text/plain; charset=us-ascii\r\n" +
+		"\r\n" +
+		"caf\xe9\r\n" +
+		strings.Repeat("--Enmime-Spam\r\nContent-Type: text/plain\r\n\r\nx\r\n", 50) +
+		"--Enmime-Spam--\r\n"
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	mime, err := (&Parser{KeepRawBody: true}).ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	assert.Equal(t, mime.StructuralSpamSignals(),
+		[]string{"mismatched-charset", "excessive-parts"}, "Expected the charset and parts signals")
+}
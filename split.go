@@ -0,0 +1,170 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"strings"
+)
+
+// SplitMessages parses a stream of concatenated RFC 822 messages, such as an mbox file or a
+// looser dump, returning the root part of each message in order.  A new message is started
+// at:
+//
+//   - an mbox "From " line at the start of the stream or after a blank line, if the next line
+//     is a header field; the "From " line itself is dropped
+//   - a blank line followed by a complete header block, every line of which is a header field
+//     or a continuation, that holds From and MIME-Version fields along with a field added in
+//     transport or by the sending server: Received, Return-Path or Message-Id
+//
+// The second rule asks for more than a From, Subject and Date, as mail clients quote those
+// fields at the top of an inline forward.  As a forwarded message inside a multipart has the
+// same shape, blank-line separators are only looked for once the closing boundary of a
+// multipart message has been seen.  Text that
+// matches neither rule stays in the current message, so a malformed separator joins two
+// messages rather than splitting one.  Blank text between messages is ignored.  An error is
+// returned, with the messages parsed so far, if a message cannot be parsed.  Messages without
+// a Content-Type header are parsed as text/plain.
+func SplitMessages(r io.Reader) ([]MIMEPart, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitLines(data)
+	var roots []MIMEPart
+	start := 0
+	closing := ""
+	flush := func(end int) error {
+		message := bytes.Join(lines[start:end], nil)
+		start = end
+		if len(bytes.TrimSpace(message)) == 0 {
+			return nil
+		}
+		root, err := new(Parser).parseMessage(message)
+		if err != nil {
+			return fmt.Errorf("Message %v: %v", len(roots)+1, err)
+		}
+		roots = append(roots, root)
+		return nil
+	}
+	inHeader := true
+	for i := 0; i < len(lines); i++ {
+		line := bytes.TrimRight(lines[i], "\r\n")
+		afterBlank := i == 0 || len(bytes.TrimRight(lines[i-1], "\r\n")) == 0
+		if afterBlank && bytes.HasPrefix(line, []byte("From ")) &&
+			i+1 < len(lines) && headerField.Match(lines[i+1]) {
+			if err := flush(i); err != nil {
+				return roots, err
+			}
+			start, inHeader, closing = i+1, true, ""
+			continue
+		}
+		if inHeader {
+			if len(line) == 0 {
+				inHeader = false
+				closing = splitBoundary(lines[start:i])
+			}
+			continue
+		}
+		if closing != "" {
+			if string(bytes.TrimRight(line, " \t")) == closing {
+				closing = ""
+			}
+			continue
+		}
+		if len(line) == 0 && isMessageHeader(lines[i+1:]) {
+			if err := flush(i + 1); err != nil {
+				return roots, err
+			}
+			inHeader = true
+		}
+	}
+	if err := flush(len(lines)); err != nil {
+		return roots, err
+	}
+	return roots, nil
+}
+
+// parseMessage parses a complete message held in memory like ParseMIME, except that a message
+// without a Content-Type header, as is common in mbox files, is parsed as text/plain like
+// ParseMIMEBody does.
+func (p *Parser) parseMessage(message []byte) (MIMEPart, error) {
+	br := bufio.NewReader(bytes.NewReader(message))
+	header, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	if header.Get("Content-Type") != "" {
+		return p.ParseMIME(bufio.NewReader(bytes.NewReader(message)))
+	}
+	root := &memMIMEPart{header: header, contentType: "text/plain"}
+	tee, raw := p.teeRaw(p.reset(br))
+	root.content, root.charset, err = p.decodeContent("text/plain", nil,
+		header.Get("Content-Transfer-Encoding"), tee)
+	if err != nil {
+		return nil, err
+	}
+	p.recordSize(root)
+	if root.rawContent, err = raw(); err != nil {
+		return nil, err
+	}
+	p.linkYEnc(root)
+	return root, nil
+}
+
+// splitLines splits data into lines, keeping their line endings.
+func splitLines(data []byte) [][]byte {
+	var lines [][]byte
+	for len(data) > 0 {
+		next := bytes.IndexByte(data, '\n') + 1
+		if next == 0 {
+			next = len(data)
+		}
+		lines = append(lines, data[:next])
+		data = data[next:]
+	}
+	return lines
+}
+
+// splitBoundary returns the closing delimiter line of the message whose header is held in
+// lines, or the empty string if it is not a multipart.
+func splitBoundary(lines [][]byte) string {
+	header, err := ParseHeaderBlock(bytes.Join(lines, nil))
+	if err != nil {
+		return ""
+	}
+	mediatype, params, err := parseMediaType(header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediatype, "multipart/") || params["boundary"] == "" {
+		return ""
+	}
+	return "--" + params["boundary"] + "--"
+}
+
+// isMessageHeader reports whether lines start with a complete header block, ending at a blank
+// line or the end of the stream, that holds the fields SplitMessages requires of a message
+// following a blank line.
+func isMessageHeader(lines [][]byte) bool {
+	fields := make(map[string]bool)
+	for i, raw := range lines {
+		line := bytes.TrimRight(raw, "\r\n")
+		if len(line) == 0 {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if i == 0 {
+				return false
+			}
+			continue
+		}
+		if !headerField.Match(line) {
+			return false
+		}
+		name := string(line[:bytes.IndexByte(line, ':')])
+		fields[textproto.CanonicalMIMEHeaderKey(name)] = true
+	}
+	return fields["From"] && fields["Mime-Version"] &&
+		(fields["Received"] || fields["Return-Path"] || fields["Message-Id"])
+}
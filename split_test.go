@@ -0,0 +1,64 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSplitMessages(t *testing.T) {
+	stream := "From alice@example.com Mon Jan  1 00:00:00 2024\n" +
+		"From: alice@example.com\nSubject: One\n\nFirst body\n\n" +
+		"From bob@example.com Mon Jan  1 00:00:00 2024\n" +
+		"From: bob@example.com\nSubject: Two\n\n" +
+		"From here on\nsecond body\n\n" +
+		"Return-Path: <carol@example.com>\n" +
+		"From: carol@example.com\nDate: Mon, 1 Jan 2024 00:00:00 +0000\n" +
+		"Subject: Three\nMIME-Version: 1.0\n\n" +
+		"Third body\n"
+	roots, err := SplitMessages(strings.NewReader(stream))
+	if !assert.Nil(t, err, "Should split the stream") {
+		t.FailNow()
+	}
+	if assert.Equal(t, len(roots), 3, "Should find three messages") {
+		assert.Equal(t, roots[0].Header().Get("Subject"), "One", "First message")
+		assert.Equal(t, string(roots[0].Content()), "First body\n\n", "From line should be dropped")
+		assert.Equal(t, string(roots[1].Content()), "From here on\nsecond body\n\n",
+			"From line without a header should stay in the body")
+		assert.Equal(t, roots[2].Header().Get("Subject"), "Three", "Blank line separator")
+		assert.Equal(t, roots[2].ContentType(), "text/plain", "Missing type should be text")
+	}
+}
+
+func TestSplitMessagesForwarded(t *testing.T) {
+	stream := "From: alice@example.com\nContent-Type: multipart/mixed; boundary=b\n\n" +
+		"--b\nContent-Type: message/rfc822\n\n" +
+		"From: bob@example.com\nDate: Mon, 1 Jan 2024 00:00:00 +0000\n\nForwarded\n\n" +
+		"--b--\n\n" +
+		"From: carol@example.com\nMessage-Id: <3@example.com>\nMIME-Version: 1.0\n" +
+		"Content-Type: text/plain\n\nNext\n"
+	roots, err := SplitMessages(strings.NewReader(stream))
+	if !assert.Nil(t, err, "Should split the stream") {
+		t.FailNow()
+	}
+	if assert.Equal(t, len(roots), 2, "Forwarded message should not be split out") {
+		assert.Equal(t, roots[0].FirstChild().ContentType(), "message/rfc822", "Forwarded part")
+		assert.Equal(t, roots[1].Header().Get("From"), "carol@example.com", "Second message")
+	}
+}
+
+func TestSplitMessagesInlineForward(t *testing.T) {
+	stream := "From: alice@example.com\r\nSubject: Fwd: Hello\r\n\r\n" +
+		"See below.\r\n\r\nBegin forwarded message:\r\n\r\n" +
+		"From: bob@example.com\r\nSubject: Hello\r\nDate: Mon, 1 Jan 2024 00:00:00 +0000\r\n" +
+		"Message-Id: <1@example.com>\r\n\r\n" +
+		"Forwarded body\r\n"
+	roots, err := SplitMessages(strings.NewReader(stream))
+	if !assert.Nil(t, err, "Should split the stream") {
+		t.FailNow()
+	}
+	if assert.Equal(t, len(roots), 1, "Inline forward should not be split out") {
+		assert.Contains(t, string(roots[0].Content()), "Forwarded body",
+			"Forward should stay in the body")
+	}
+}
@@ -0,0 +1,91 @@
+package enmime
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// messageID matches a single message identifier in a References or In-Reply-To header.
+	messageID = regexp.MustCompile(`<[^<>\s]+>`)
+
+	// replyPrefix matches a single reply or forward prefix at the start of a subject, e.g.
+	// "Re:", "Re[2]:" or "FWD:".
+	replyPrefix = regexp.MustCompile(`^(?i:re|fwd?)(?:\[\d+\])?\s*:\s*`)
+
+	// listTag matches a mailing list tag at the start of a subject, e.g. "[golang-nuts]".
+	listTag = regexp.MustCompile(`^\[[^\]]*\]\s*`)
+)
+
+// Options for MIMEBody.NormalizedSubject, combined with the | operator.
+const (
+	StripReplyPrefixes = 1 << iota // Remove "Re:", "Fw:" and "Fwd:" prefixes
+	StripListTags                  // Remove mailing list tags such as "[listname]"
+)
+
+// ThreadKey returns a key for grouping the message with the others in its conversation.  It
+// combines the normalized subject with the root of the thread: the first message ID in the
+// References header, else the In-Reply-To header, else the message's own Message-ID.
+//
+// The subject is normalized by decoding any RFC 2047 encoded-words, repeatedly removing
+// leading "Re:", "Fw:" and "Fwd:" prefixes (in any case, optionally counted as in "Re[2]:")
+// and mailing list tags such as "[listname]", collapsing runs of whitespace and converting to
+// lower case.  The key is stable across parses of the same message, but is only a heuristic:
+// replies that change the subject, or clients that drop the threading headers, end up with
+// keys of their own.
+func (m *MIMEBody) ThreadKey() string {
+	root := messageID.FindString(m.header.Get("References"))
+	if root == "" {
+		root = messageID.FindString(m.header.Get("In-Reply-To"))
+	}
+	if root == "" {
+		root = messageID.FindString(m.header.Get("Message-Id"))
+	}
+	return normalizeSubject(DecodeHeader(m.header.Get("Subject"))) + "\n" + root
+}
+
+// Subject returns the Subject header of the message with any RFC 2047 encoded-words decoded
+// to UTF-8 and surrounding whitespace removed, or "" if there is none.
+func (m *MIMEBody) Subject() string {
+	return strings.TrimSpace(DecodeHeader(m.header.Get("Subject")))
+}
+
+// NormalizedSubject returns the Subject of the message cleaned up for display, with runs of
+// whitespace collapsed to a single space.  The options select what is removed from the start
+// of the subject, repeatedly, so that "Re: [list] Fwd: Hello" becomes "Hello" with both:
+//
+//   - StripReplyPrefixes removes "Re:", "Fw:" and "Fwd:" in any case, optionally counted as in
+//     "Re[2]:", with or without space before the colon
+//   - StripListTags removes mailing list tags, any text in square brackets such as "[listname]"
+//
+// Prefixes and tags are only removed from the start of the subject, never from the middle.
+// Unlike the subject used by ThreadKey, the case of the subject is kept.
+func (m *MIMEBody) NormalizedSubject(options int) string {
+	return stripSubject(m.Subject(), options)
+}
+
+// stripSubject removes the reply prefixes and list tags selected by options from the start
+// of subject, and collapses runs of whitespace.
+func stripSubject(subject string, options int) string {
+	subject = strings.TrimSpace(subject)
+	for {
+		loc := []int(nil)
+		if options&StripReplyPrefixes != 0 {
+			loc = replyPrefix.FindStringIndex(subject)
+		}
+		if loc == nil && options&StripListTags != 0 {
+			loc = listTag.FindStringIndex(subject)
+		}
+		if loc == nil {
+			break
+		}
+		subject = subject[loc[1]:]
+	}
+	return strings.Join(strings.Fields(subject), " ")
+}
+
+// normalizeSubject removes reply and forward prefixes and list tags from subject, see
+// ThreadKey.
+func normalizeSubject(subject string) string {
+	return strings.ToLower(stripSubject(subject, StripReplyPrefixes|StripListTags))
+}
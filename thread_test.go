@@ -0,0 +1,65 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func threadKey(t *testing.T, header string) string {
+	msg, err := mail.ReadMessage(strings.NewReader(header + "\r\nBody\r\n"))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+	return mime.ThreadKey()
+}
+
+func TestThreadKey(t *testing.T) {
+	original := threadKey(t, "Subject: Lunch plans\r\nMessage-ID: <a1@example.com>\r\n")
+	reply := threadKey(t, "Subject: RE: [team] Lunch  plans\r\nMessage-ID: <b2@example.com>\r\n"+
+		"In-Reply-To: <a1@example.com>\r\n")
+	forward := threadKey(t, "Subject: Fwd: Re[2]: Lunch plans\r\nMessage-ID: <c3@example.com>\r\n"+
+		"In-Reply-To: <b2@example.com>\r\n"+
+		"References: <a1@example.com>\r\n <b2@example.com>\r\n")
+	encoded := threadKey(t, "Subject: =?utf-8?q?Re=3A_Lunch_plans?=\r\n"+
+		"References: <a1@example.com>\r\n")
+
+	assert.Equal(t, reply, original, "Reply should share the thread key")
+	assert.Equal(t, forward, original, "Forward should share the thread key")
+	assert.Equal(t, encoded, original, "Encoded subject should share the thread key")
+
+	other := threadKey(t, "Subject: Re: Lunch plans\r\nIn-Reply-To: <z9@example.com>\r\n")
+	assert.NotEqual(t, other, original, "Different thread root should have a different key")
+}
+
+func TestNormalizeSubject(t *testing.T) {
+	assert.Equal(t, normalizeSubject("Re: Fw: [list] RE:Hello\tWorld "), "hello world",
+		"Prefixes and tags should be removed")
+	assert.Equal(t, normalizeSubject("Regarding: taxes"), "regarding: taxes",
+		"Words starting with a prefix should be kept")
+	assert.Equal(t, normalizeSubject(""), "", "Empty subject should stay empty")
+}
+
+func TestNormalizedSubject(t *testing.T) {
+	mime := &MIMEBody{header: mail.Header{
+		"Subject": {"Re: [team] =?utf-8?q?FWD=3A_Caf=C3=A9?=  plans "},
+	}}
+	assert.Equal(t, mime.Subject(), "Re: [team] FWD: Café  plans", "Subject should be decoded")
+	assert.Equal(t, mime.NormalizedSubject(0), "Re: [team] FWD: Café plans",
+		"Nothing should be stripped without options")
+	assert.Equal(t, mime.NormalizedSubject(StripReplyPrefixes), "[team] FWD: Café plans",
+		"Prefixes should only be stripped up to the list tag")
+	assert.Equal(t, mime.NormalizedSubject(StripReplyPrefixes|StripListTags), "Café plans",
+		"Prefixes and tags should be stripped repeatedly")
+
+	mime = &MIMEBody{header: mail.Header{"Subject": {"[team] Re[2]: Notes re: [draft]"}}}
+	assert.Equal(t, mime.NormalizedSubject(StripListTags), "Re[2]: Notes re: [draft]",
+		"Only the leading tag should be stripped")
+	assert.Equal(t, new(MIMEBody).NormalizedSubject(StripListTags), "",
+		"Missing subject should be empty")
+}
@@ -0,0 +1,194 @@
+package enmime
+
+import (
+	"fmt"
+	"mime"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// ComplexityStats summarizes the structure of a MIME tree, see Complexity.
+type ComplexityStats struct {
+	Parts        int   // Number of parts, including the root
+	MaxDepth     int   // Nesting depth of the deepest part, the root has a depth of 0
+	Attachments  int   // Number of attachments
+	DeclaredSize int64 // Sum of the sizes declared by Content-Disposition and Content-Length
+}
+
+// Complexity computes structural statistics for the MIME tree below root, for example to
+// apply stricter limits to complex messages from untrusted sources.  It only examines part
+// headers, not content.  DeclaredSize relies on the optional size parameter of
+// Content-Disposition or a Content-Length header; parts declaring neither contribute nothing.
+func Complexity(root MIMEPart) ComplexityStats {
+	var stats ComplexityStats
+	var walk func(p MIMEPart, depth int)
+	walk = func(p MIMEPart, depth int) {
+		stats.Parts++
+		if depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+		if isAttachment(p) {
+			stats.Attachments++
+		}
+		stats.DeclaredSize += declaredSize(p)
+		for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+			walk(c, depth+1)
+		}
+	}
+	walk(root, 0)
+	return stats
+}
+
+// declaredSize returns the size of the part according to its headers, or 0 if not declared.
+func declaredSize(p MIMEPart) int64 {
+	_, dparams, err := mime.ParseMediaType(p.Header().Get("Content-Disposition"))
+	if err == nil {
+		if size, err := strconv.ParseInt(dparams["size"], 10, 64); err == nil && size > 0 {
+			return size
+		}
+	}
+	size, err := strconv.ParseInt(p.Header().Get("Content-Length"), 10, 64)
+	if err == nil && size > 0 {
+		return size
+	}
+	return 0
+}
+
+// SiblingIndex returns the zero based position of the part among its siblings, counting from
+// its parent's FirstChild.  The root part has an index of 0.
+func SiblingIndex(p MIMEPart) int {
+	parent := p.Parent()
+	if parent == nil {
+		return 0
+	}
+	i := 0
+	for c := parent.FirstChild(); c != nil && c != p; c = c.NextSibling() {
+		i++
+	}
+	return i
+}
+
+// PathIndex returns the path of the part within its tree: the dot separated, one based
+// positions of the part and its ancestors among their siblings, like IMAP section numbers.
+// The first child of the root is "1", its second child is "1.2", and the root itself has the
+// empty path "".  Paths depend only on the structure of the tree, so parsing the same message
+// again always yields the same paths.
+func PathIndex(p MIMEPart) string {
+	var path []string
+	for ; p.Parent() != nil; p = p.Parent() {
+		path = append([]string{strconv.Itoa(SiblingIndex(p) + 1)}, path...)
+	}
+	return strings.Join(path, ".")
+}
+
+// PartByPath returns the part below root found at the path returned by PathIndex, or nil if
+// there is no such part.
+func PartByPath(root MIMEPart, path string) MIMEPart {
+	if path == "" {
+		return root
+	}
+	p := root
+	for _, field := range strings.Split(path, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 1 {
+			return nil
+		}
+		p = p.FirstChild()
+		for i := 1; i < n && p != nil; i++ {
+			p = p.NextSibling()
+		}
+		if p == nil {
+			return nil
+		}
+	}
+	return p
+}
+
+// Index returns every part in the tree below root keyed by its PathIndex, computed in a single
+// walk.  The paths are deterministic, see PathIndex, and each can be resolved back to its part
+// with PartByPath.
+func Index(root MIMEPart) map[string]MIMEPart {
+	index := make(map[string]MIMEPart)
+	var walk func(p MIMEPart, path string)
+	walk = func(p MIMEPart, path string) {
+		index[path] = p
+		prefix := ""
+		if path != "" {
+			prefix = path + "."
+		}
+		i := 1
+		for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+			walk(c, prefix+strconv.Itoa(i))
+			i++
+		}
+	}
+	walk(root, "")
+	return index
+}
+
+// Redact returns a copy of the tree below root for logging its structure without leaking the
+// message: every header, content type, disposition and file name is kept, but the content of
+// each part is replaced with a placeholder such as "[redacted 1024 bytes]" giving its decoded
+// size.  Parts without content keep an empty content.  The copy shares nothing with root.
+func Redact(root MIMEPart) MIMEPart {
+	return redact(root, nil)
+}
+
+// redact copies p and its descendants below the given parent, see Redact.
+func redact(p MIMEPart, parent MIMEPart) *memMIMEPart {
+	clone := &memMIMEPart{
+		parent:      parent,
+		header:      make(textproto.MIMEHeader, len(p.Header())),
+		contentType: p.ContentType(),
+		disposition: p.Disposition(),
+		fileName:    p.FileName(),
+		charset:     Charset(p),
+	}
+	for key, values := range p.Header() {
+		clone.header[key] = append([]string(nil), values...)
+	}
+	if size := len(p.Content()); size > 0 {
+		clone.content = []byte("[redacted " + strconv.Itoa(size) + " bytes]")
+	}
+	var prev *memMIMEPart
+	for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+		child := redact(c, clone)
+		if prev == nil {
+			clone.firstChild = child
+		} else {
+			prev.nextSibling = child
+		}
+		prev = child
+	}
+	return clone
+}
+
+// CheckBoundaries reports the multipart parts below root whose boundary collides with the
+// boundary of one of their ancestors, a diagnostic for testing message generators.  Boundaries
+// collide if they are equal, or if one is a prefix of the other, as a delimiter line for the
+// longer boundary also starts with the delimiter of the shorter one (RFC 2046, section
+// 5.1.1).  The Offset of the returned errors is always 0; the Detail names the part by its
+// PathIndex.
+func CheckBoundaries(root MIMEPart) []*Error {
+	var errors []*Error
+	var walk func(p MIMEPart, ancestors []string)
+	walk = func(p MIMEPart, ancestors []string) {
+		_, params, err := parseMediaType(p.Header().Get("Content-Type"))
+		if boundary := params["boundary"]; err == nil && boundary != "" {
+			for _, outer := range ancestors {
+				if strings.HasPrefix(boundary, outer) || strings.HasPrefix(outer, boundary) {
+					errors = append(errors, &Error{Name: "Boundary Collision", Detail: fmt.Sprintf(
+						"Boundary %q of part %q collides with ancestor boundary %q", boundary,
+						PathIndex(p), outer)})
+				}
+			}
+			ancestors = append(ancestors[:len(ancestors):len(ancestors)], boundary)
+		}
+		for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+			walk(c, ancestors)
+		}
+	}
+	walk(root, nil)
+	return errors
+}
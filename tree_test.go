@@ -0,0 +1,160 @@
+package enmime
+
+import (
+	"github.com/stretchrcom/testify/assert"
+	"net/textproto"
+	"testing"
+)
+
+func TestSiblingIndex(t *testing.T) {
+	// Setup test MIME tree:
+	//    root
+	//    ├── a1
+	//    │   ├── b1
+	//    │   └── b2
+	//    ├── a2
+	//    └── a3
+
+	root := &memMIMEPart{contentType: "multipart/alternative"}
+	a1 := &memMIMEPart{contentType: "multipart/related", parent: root}
+	a2 := &memMIMEPart{contentType: "text/plain", parent: root}
+	a3 := &memMIMEPart{contentType: "text/html", parent: root}
+	b1 := &memMIMEPart{contentType: "text/plain", parent: a1}
+	b2 := &memMIMEPart{contentType: "text/html", parent: a1}
+	root.firstChild = a1
+	a1.nextSibling = a2
+	a2.nextSibling = a3
+	a1.firstChild = b1
+	b1.nextSibling = b2
+
+	assert.Equal(t, SiblingIndex(root), 0, "Root should have index 0")
+	assert.Equal(t, SiblingIndex(a1), 0, "a1 should have index 0")
+	assert.Equal(t, SiblingIndex(a2), 1, "a2 should have index 1")
+	assert.Equal(t, SiblingIndex(a3), 2, "a3 should have index 2")
+	assert.Equal(t, SiblingIndex(b1), 0, "b1 should have index 0")
+	assert.Equal(t, SiblingIndex(b2), 1, "b2 should have index 1")
+}
+
+func TestComplexity(t *testing.T) {
+	msg := readMessage("appledouble.raw")
+	mime, err := ParseMIMEBody(msg)
+	if err != nil {
+		t.Fatalf("Failed to parse MIME: %v", err)
+	}
+
+	stats := Complexity(mime.Root)
+	assert.Equal(t, stats.Parts, 5, "Should count every part")
+	assert.Equal(t, stats.MaxDepth, 2, "Should find deepest part")
+	assert.Equal(t, stats.Attachments, 1, "Should count attachments")
+	assert.Equal(t, stats.DeclaredSize, int64(0), "Test message declares no sizes")
+}
+
+func TestComplexityDeclaredSize(t *testing.T) {
+	root := &memMIMEPart{contentType: "multipart/mixed"}
+	a1 := &memMIMEPart{contentType: "application/pdf", parent: root, disposition: "attachment",
+		header: textproto.MIMEHeader{"Content-Disposition": {"attachment; filename=a.pdf; size=1000"}}}
+	a2 := &memMIMEPart{contentType: "text/plain", parent: root,
+		header: textproto.MIMEHeader{"Content-Length": {"24"}}}
+	root.firstChild = a1
+	a1.nextSibling = a2
+
+	stats := Complexity(root)
+	assert.Equal(t, stats.Parts, 3, "Should count every part")
+	assert.Equal(t, stats.MaxDepth, 1, "Should find deepest part")
+	assert.Equal(t, stats.Attachments, 1, "Should count attachments")
+	assert.Equal(t, stats.DeclaredSize, int64(1024), "Should sum declared sizes")
+}
+
+func TestPathIndex(t *testing.T) {
+	// Setup test MIME tree:
+	//    root
+	//    ├── a1
+	//    │   ├── b1
+	//    │   └── b2
+	//    └── a2
+
+	root := &memMIMEPart{contentType: "multipart/mixed"}
+	a1 := &memMIMEPart{contentType: "multipart/alternative", parent: root}
+	a2 := &memMIMEPart{contentType: "image/png", parent: root}
+	b1 := &memMIMEPart{contentType: "text/plain", parent: a1}
+	b2 := &memMIMEPart{contentType: "text/html", parent: a1}
+	root.firstChild = a1
+	a1.nextSibling = a2
+	a1.firstChild = b1
+	b1.nextSibling = b2
+
+	assert.Equal(t, PathIndex(root), "", "Root should have an empty path")
+	assert.Equal(t, PathIndex(a1), "1", "a1 should have path 1")
+	assert.Equal(t, PathIndex(a2), "2", "a2 should have path 2")
+	assert.Equal(t, PathIndex(b2), "1.2", "b2 should have path 1.2")
+
+	assert.Equal(t, PartByPath(root, "1.2"), b2, "Path 1.2 should resolve to b2")
+	assert.Equal(t, PartByPath(root, ""), root, "Empty path should resolve to root")
+	assert.Nil(t, PartByPath(root, "1.3"), "Missing part should resolve to nil")
+	assert.Nil(t, PartByPath(root, "x"), "Malformed path should resolve to nil")
+
+	index := Index(root)
+	assert.Equal(t, len(index), 5, "Index should contain every part")
+	for path, p := range index {
+		assert.Equal(t, PathIndex(p), path, "Index key should match PathIndex")
+		assert.Equal(t, PartByPath(root, path), p, "Index key should resolve with PartByPath")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	root, err := ParseMIME(openPart("multibase64.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+
+	redacted := Redact(root)
+	assert.Equal(t, redacted.ContentType(), "multipart/mixed", "Root type should be kept")
+	assert.Equal(t, len(redacted.Content()), 0, "Container should have no content")
+
+	text := redacted.FirstChild()
+	if !assert.NotNil(t, text, "Redacted root should have a FirstChild") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(text.Content()), "[redacted 14 bytes]", "Text should be redacted")
+	assert.Equal(t, text.Parent(), redacted, "Parent should be the redacted root")
+
+	html := text.NextSibling()
+	if !assert.NotNil(t, html, "Redacted text should have a sibling") {
+		t.FailNow()
+	}
+	assert.Equal(t, string(html.Content()), "[redacted 7 bytes]", "HTML should be redacted")
+	assert.Equal(t, html.FileName(), "test.html", "File name should be kept")
+	assert.Equal(t, html.Disposition(), "attachment", "Disposition should be kept")
+	assert.Equal(t, html.Header(), root.FirstChild().NextSibling().Header(),
+		"Header should be kept")
+
+	html.Header().Set("Content-Type", "text/plain")
+	assert.Equal(t, root.FirstChild().NextSibling().Header().Get("Content-Type"),
+		"text/html; name=\"test.html\"", "Original header should not be shared")
+	assert.Equal(t, string(root.FirstChild().Content()), "A text section",
+		"Original content should be untouched")
+}
+
+func TestCheckBoundaries(t *testing.T) {
+	root, err := ParseMIME(openPart("nestedmulti.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, len(CheckBoundaries(root)), 0, "Distinct boundaries should not collide")
+
+	outer := &memMIMEPart{contentType: "multipart/mixed", header: textproto.MIMEHeader{
+		"Content-Type": {"multipart/mixed; boundary=outer"}}}
+	inner := &memMIMEPart{contentType: "multipart/alternative", parent: outer,
+		header: textproto.MIMEHeader{
+			"Content-Type": {"multipart/alternative; boundary=outer-1"}}}
+	sibling := &memMIMEPart{contentType: "multipart/related", parent: outer,
+		header: textproto.MIMEHeader{"Content-Type": {"multipart/related; boundary=other"}}}
+	outer.firstChild = inner
+	inner.nextSibling = sibling
+
+	errors := CheckBoundaries(outer)
+	if assert.Equal(t, len(errors), 1, "Prefixed boundary should collide") {
+		assert.Equal(t, errors[0].Name, "Boundary Collision", "Error should name the problem")
+		assert.Contains(t, errors[0].Detail, `"1"`, "Detail should name the part")
+	}
+}
@@ -0,0 +1,189 @@
+package enmime
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"mime"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// YEncFile is a file decoded from a yEnc block, as found in the text of mail gatewayed from
+// Usenet.
+type YEncFile struct {
+	Name    string // File name from the =ybegin line
+	Size    int64  // Size of the whole file from the =ybegin line
+	Part    int    // Part number of a multi-part file, 0 for a single part file
+	CRC32   uint32 // CRC-32 of Content declared by the =yend line, 0 if not declared
+	Content []byte // Decoded bytes of the block
+}
+
+// DecodeYEnc decodes the yEnc blocks found in content, each running from a =ybegin line to a
+// =yend line, and returns the files in the order found.  Text outside of the blocks is
+// ignored.  The size and CRC-32 declared by the =yend line are verified when present: for a
+// part of a multi-part file the part CRC (pcrc32) is checked, as the CRC of the whole file
+// cannot be.  An error is returned for the first block that is malformed or fails
+// verification.
+func DecodeYEnc(content []byte) ([]*YEncFile, error) {
+	files, errs := decodeYEncBlocks(content)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return files, nil
+}
+
+// decodeYEncBlocks decodes the yEnc blocks in content like DecodeYEnc, returning the files
+// that could be decoded along with an error for each block that could not.
+func decodeYEncBlocks(content []byte) ([]*YEncFile, []error) {
+	var files []*YEncFile
+	var errs []error
+	lines := bytes.Split(content, []byte("\n"))
+	for i := 0; i < len(lines); i++ {
+		line := string(bytes.TrimRight(lines[i], "\r"))
+		if !strings.HasPrefix(line, "=ybegin ") {
+			continue
+		}
+		params := yencParams(line[len("=ybegin "):])
+		file := &YEncFile{Name: params["name"]}
+		file.Size, _ = strconv.ParseInt(params["size"], 10, 64)
+		file.Part, _ = strconv.Atoi(params["part"])
+		var trailer map[string]string
+		for i++; i < len(lines); i++ {
+			data := bytes.TrimRight(lines[i], "\r")
+			if bytes.HasPrefix(data, []byte("=yend")) {
+				trailer = yencParams(string(bytes.TrimPrefix(data, []byte("=yend"))))
+				break
+			}
+			if !bytes.HasPrefix(data, []byte("=ypart ")) {
+				file.Content = append(file.Content, yencDecodeLine(data)...)
+			}
+		}
+		if trailer == nil {
+			errs = append(errs, fmt.Errorf("yEnc block for %q has no =yend line", file.Name))
+			break
+		}
+		if err := file.verify(trailer); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, errs
+}
+
+// verify checks the decoded content of f against the size and CRC-32 of the =yend trailer,
+// setting the CRC32 of f when declared.
+func (f *YEncFile) verify(trailer map[string]string) error {
+	if size, ok := trailer["size"]; ok && size != strconv.Itoa(len(f.Content)) {
+		return fmt.Errorf("yEnc block for %q declares %v bytes, decoded %v", f.Name, size,
+			len(f.Content))
+	}
+	key := "crc32"
+	if f.Part > 0 {
+		key = "pcrc32"
+	}
+	declared, ok := trailer[key]
+	if !ok {
+		return nil
+	}
+	crc, err := strconv.ParseUint(declared, 16, 32)
+	if err != nil {
+		return fmt.Errorf("yEnc block for %q has a malformed %v of %q", f.Name, key, declared)
+	}
+	if uint32(crc) != crc32.ChecksumIEEE(f.Content) {
+		return fmt.Errorf("yEnc block for %q fails its %v check", f.Name, key)
+	}
+	f.CRC32 = uint32(crc)
+	return nil
+}
+
+// yencParams parses the key=value parameters of a yEnc control line.  The name parameter is
+// always last and extends to the end of the line, as file names may contain spaces.
+func yencParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return params
+		}
+		if strings.HasPrefix(s, "name=") {
+			params["name"] = strings.TrimRight(s[len("name="):], " ")
+			return params
+		}
+		field := s
+		if space := strings.IndexByte(s, ' '); space >= 0 {
+			field, s = s[:space], s[space:]
+		} else {
+			s = ""
+		}
+		if eq := strings.IndexByte(field, '='); eq >= 0 {
+			params[strings.ToLower(field[:eq])] = field[eq+1:]
+		}
+	}
+}
+
+// yencDecodeLine decodes a line of yEnc data: each byte is offset by 42, and a byte following
+// an equals sign by a further 64.
+func yencDecodeLine(line []byte) []byte {
+	decoded := make([]byte, 0, len(line))
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '=' && i+1 < len(line) {
+			i++
+			c = line[i] - 64
+		}
+		decoded = append(decoded, c-42)
+	}
+	return decoded
+}
+
+// findYEnc looks for yEnc blocks in the content of a text/plain part, or of a body without a
+// Content-Type, when DecodeYEnc is set, keeping the decoded files for linkYEnc.  It must see
+// the content before charset conversion, which would alter the 8-bit bytes yEnc relies on.
+// Blocks that cannot be decoded are recorded in the Errors.
+func (p *Parser) findYEnc(mediatype string, content []byte) {
+	p.yenc = nil
+	if !p.DecodeYEnc || mediatype != "text/plain" && mediatype != "" ||
+		!bytes.Contains(content, []byte("=ybegin ")) {
+		return
+	}
+	files, errs := decodeYEncBlocks(content)
+	for _, err := range errs {
+		p.addError("Malformed yEnc", "%v", err)
+	}
+	p.yenc = files
+}
+
+// linkYEnc links the files found by the last findYEnc below part, as attachments named after
+// the files, and returns them.
+func (p *Parser) linkYEnc(part *memMIMEPart) []MIMEPart {
+	var attachments []MIMEPart
+	var prev *memMIMEPart
+	for _, file := range p.yenc {
+		child := NewMIMEPart(part, "application/octet-stream")
+		child.header = textproto.MIMEHeader{
+			"Content-Type":        {child.contentType},
+			"Content-Disposition": {"attachment"},
+		}
+		if file.Name != "" {
+			child.header.Set("Content-Type", mime.FormatMediaType(child.contentType,
+				map[string]string{"name": file.Name}))
+			child.header.Set("Content-Disposition", mime.FormatMediaType("attachment",
+				map[string]string{"filename": file.Name}))
+		}
+		child.disposition = "attachment"
+		child.fileName = file.Name
+		child.content = file.Content
+		if prev == nil {
+			part.firstChild = child
+		} else {
+			prev.nextSibling = child
+		}
+		prev = child
+		attachments = append(attachments, child)
+	}
+	p.yenc = nil
+	return attachments
+}
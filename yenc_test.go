@@ -0,0 +1,63 @@
+package enmime
+
+import (
+	"fmt"
+	"github.com/stretchrcom/testify/assert"
+	"hash/crc32"
+	"testing"
+)
+
+func TestDecodeYEnc(t *testing.T) {
+	// "Hello" encoded, with an escaped byte written for the yEnc special character =
+	part := "=ybegin part=2 total=2 line=128 size=100 name=my file.txt\r\n" +
+		"=ypart begin=51 end=55\r\n" +
+		"r\x8f\x96\x96\x99=}\r\n" +
+		"=yend size=6 part=2 pcrc32=%08x crc32=ffffffff\r\n"
+	content := []byte("Hello\x13")
+	files, err := DecodeYEnc([]byte(fmt.Sprintf(part, crc32.ChecksumIEEE(content))))
+	if !assert.Nil(t, err, "Valid block should decode") {
+		t.FailNow()
+	}
+	if assert.Equal(t, len(files), 1, "Should find one block") {
+		assert.Equal(t, files[0].Name, "my file.txt", "Name should extend to the line end")
+		assert.Equal(t, files[0].Size, int64(100), "Size should be that of the whole file")
+		assert.Equal(t, files[0].Part, 2, "Part number should be kept")
+		assert.Equal(t, files[0].Content, content, "Content should be decoded")
+		assert.Equal(t, files[0].CRC32, crc32.ChecksumIEEE(content), "Part CRC should be kept")
+	}
+
+	_, err = DecodeYEnc([]byte("=ybegin line=128 size=1 name=a\r\nk\r\n"))
+	assert.NotNil(t, err, "Block without =yend should be an error")
+	_, err = DecodeYEnc([]byte("=ybegin line=128 size=1 name=a\r\nk\r\n=yend size=2\r\n"))
+	assert.NotNil(t, err, "Wrong size should be an error")
+}
+
+func TestParserDecodeYEnc(t *testing.T) {
+	p := &Parser{DecodeYEnc: true}
+	mime, err := p.ParseMIMEBody(readMessage("yenc.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Contains(t, mime.Text, "Here is the file", "Text should be kept")
+	if assert.Equal(t, len(mime.Attachments), 1, "Valid block should be an attachment") {
+		att := mime.Attachments[0]
+		assert.Equal(t, att.FileName(), "all bytes.bin", "Attachment should be named")
+		assert.Equal(t, att.Parent(), mime.TextPart, "Attachment should be below the text")
+		if assert.Equal(t, len(att.Content()), 256, "Content should be decoded") {
+			for i, b := range att.Content() {
+				if b != byte(i) {
+					t.Fatalf("Byte %v decoded as %v", i, b)
+				}
+			}
+		}
+	}
+	if assert.Equal(t, len(mime.Errors), 1, "Broken block should be recorded") {
+		assert.Equal(t, mime.Errors[0].Name, "Malformed yEnc", "Error should name the problem")
+	}
+
+	mime, err = ParseMIMEBody(readMessage("yenc.raw"))
+	if !assert.Nil(t, err, "Parsing should not have generated an error") {
+		t.FailNow()
+	}
+	assert.Equal(t, len(mime.Attachments), 0, "yEnc should not be decoded by default")
+}